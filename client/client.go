@@ -0,0 +1,281 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package client signs and sends requests to the BOLT engine, or to any service using security.Middleware.
+// Example usage:
+//
+//	c := client.New("http://localhost:8888", "mygroup", "mykey")
+//	var product Product
+//	_, err := c.Call(ctx, "v1/getProduct", map[string]string{"sku": "123"}, &product)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/TeamFairmont/boltshared/security"
+)
+
+// Engine paths used by Client
+const (
+	RequestPath  = "/request/" // + api call name, runs an api call
+	RetrievePath = "/retr/"    // + request id, returns the result of a call that timed out
+)
+
+// Backoff controls how a Client retries failed requests.  Api calls may not be safe to run twice, so a RequestPath
+// request is only retried if it failed before it was sent, or with 429 or 503, which the engine answers without running
+// the call.  RetrievePath polls are also retried after any network error, 502 or 504.
+// The wait doubles from Initial up to Max, with up to half of it added at random so clients don't retry together.
+// A Retry-After header from the server is used instead when it's longer.
+type Backoff struct {
+	Attempts int           // 3, tries in total; 1 never retries
+	Initial  time.Duration // 100ms
+	Max      time.Duration // 5s
+}
+
+// DefaultBackoff is the Backoff used by New
+var DefaultBackoff = Backoff{Attempts: 3, Initial: 100 * time.Millisecond, Max: 5 * time.Second}
+
+// DefaultPollInterval is how often Call polls for a result when PollInterval isn't set
+const DefaultPollInterval = 500 * time.Millisecond
+
+// Client calls the engine's api calls as a security group.  Its fields may be changed before the first call.
+type Client struct {
+	BaseURL      string         // ex: http://localhost:8888
+	Group        string         // the security group name
+	Key          string         // the group's hmackey
+	AuthMode     int            // config.AuthModeHMAC signs each request; config.AuthModeSimple sends the key
+	HTTPClient   *http.Client   // http.DefaultClient if nil
+	Backoff      Backoff        // retries, DefaultBackoff from New
+	PollInterval time.Duration  // DefaultPollInterval if 0
+	Clock        security.Clock // for request timestamps, security.SystemClock if nil
+}
+
+// New returns a Client using hmac auth, DefaultBackoff and polling every 500ms
+func New(baseURL string, group string, key string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		Group:        group,
+		Key:          key,
+		AuthMode:     config.AuthModeHMAC,
+		Backoff:      DefaultBackoff,
+		PollInterval: DefaultPollInterval,
+	}
+}
+
+// Response is the engine's reply to an api call.  When the call takes longer than its resultTimeoutMs the engine
+// replies with the request's ID and Complete false; Call then polls for the result.
+type Response struct {
+	ID          string          `json:"id"`
+	Complete    bool            `json:"complete"`
+	ReturnValue json.RawMessage `json:"return_value"`
+	Error       json.RawMessage `json:"error,omitempty"`
+}
+
+// StatusError is returned when the server answers with an error status that isn't retried,
+// or still answers with a retried status after the last attempt
+type StatusError struct {
+	StatusCode int
+	Message    string // the error from a security.MiddlewareError body, or the body itself
+}
+
+func (e *StatusError) Error() string {
+	return "Client error- " + strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode) + ": " + e.Message
+}
+
+// Call runs apiCall with params marshaled to json as its input, and unmarshals the return value into result
+// unless result is nil.  If the call times out on the engine, Call polls RetrievePath every PollInterval until the result
+// is complete or ctx is done.  The returned Response holds the raw reply; if polling fails it's the last incomplete one,
+// whose ID can be retrieved later.
+func (c *Client) Call(ctx context.Context, apiCall string, params interface{}, result interface{}) (*Response, error) {
+	input, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(ctx, RequestPath+strings.TrimLeft(apiCall, "/"), input, false)
+	if err != nil {
+		return nil, err
+	}
+
+	pollInterval := c.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = DefaultPollInterval
+	}
+	for !resp.Complete && resp.ID != "" {
+		select {
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+		next, err := c.send(ctx, RetrievePath+url.PathEscape(resp.ID), nil, true)
+		if err != nil {
+			return resp, err
+		}
+		resp = next
+	}
+
+	if result != nil && len(resp.ReturnValue) > 0 {
+		if err := json.Unmarshal(resp.ReturnValue, result); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+// send posts message to path, retrying with backoff, and decodes the Response.
+// Unless idempotent is set, requests the server may have acted on aren't retried.
+func (c *Client) send(ctx context.Context, path string, message []byte, idempotent bool) (*Response, error) {
+	attempts := c.Backoff.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var lastErr error
+	var serverWait time.Duration
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(c.backoff(attempt, serverWait)):
+			}
+		}
+
+		body, status, header, sent, err := c.post(ctx, path, message)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if sent && !idempotent {
+				return nil, err
+			}
+			lastErr, serverWait = err, 0
+			continue
+		}
+		if status >= 200 && status < 300 {
+			var resp Response
+			if err := json.Unmarshal(body, &resp); err != nil {
+				return nil, err
+			}
+			return &resp, nil
+		}
+
+		if !retryable(status, idempotent) {
+			return nil, statusError(status, body)
+		}
+		lastErr, serverWait = statusError(status, body), retryAfter(header)
+	}
+	return nil, lastErr
+}
+
+// post signs and sends one request, and returns the response body.
+// sent reports whether the request was written to the server, so it may have been acted on even if err is set.
+func (c *Client) post(ctx context.Context, path string, message []byte) (body []byte, status int, header http.Header, sent bool, err error) {
+	var reqBody []byte
+	switch c.AuthMode {
+	case config.AuthModeSimple:
+		reqBody = message
+	default:
+		clock := c.Clock
+		if clock == nil {
+			clock = security.SystemClock
+		}
+		nonce, err := security.NewNonce()
+		if err != nil {
+			return nil, 0, nil, false, err
+		}
+		// Signed on every attempt, so retries carry a current timestamp and a fresh nonce
+		timestamp := strconv.FormatInt(clock.Now().Unix(), 10)
+		if reqBody, err = security.EncodeHMACWithNonce(c.Key, string(message), timestamp, nonce); err != nil {
+			return nil, 0, nil, false, err
+		}
+	}
+
+	req, err := http.NewRequest("POST", c.BaseURL+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, 0, nil, false, err
+	}
+	// The transport writes the request on its own goroutine, so this is only read once Do has returned
+	var wrote int32
+	trace := &httptrace.ClientTrace{
+		WroteHeaders: func() { atomic.StoreInt32(&wrote, 1) },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(security.HeaderGroup, c.Group)
+	if c.AuthMode == config.AuthModeSimple {
+		req.Header.Set(security.HeaderKey, c.Key)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, 0, nil, atomic.LoadInt32(&wrote) == 1, err
+	}
+	defer resp.Body.Close()
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, nil, true, err
+	}
+	return body, resp.StatusCode, resp.Header, true, nil
+}
+
+// backoff returns how long to wait before the given retry, or serverWait from the last response's Retry-After if longer
+func (c *Client) backoff(attempt int, serverWait time.Duration) time.Duration {
+	wait := c.Backoff.Initial << uint(attempt-1)
+	if wait <= 0 || (c.Backoff.Max > 0 && wait > c.Backoff.Max) {
+		wait = c.Backoff.Max
+	}
+	if wait > 0 {
+		wait += time.Duration(rand.Int63n(int64(wait)/2 + 1))
+	}
+	if serverWait > wait {
+		wait = serverWait
+	}
+	return wait
+}
+
+// retryable reports whether a status may be retried.  429 and 503 mean the request wasn't acted on;
+// 502 and 504 may have been sent on by a proxy, so they're only retried for idempotent requests.
+func retryable(status int, idempotent bool) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+func statusError(status int, body []byte) *StatusError {
+	var merr security.MiddlewareError
+	if err := json.Unmarshal(body, &merr); err == nil && merr.Error != "" {
+		return &StatusError{StatusCode: status, Message: merr.Error}
+	}
+	return &StatusError{StatusCode: status, Message: strings.TrimSpace(string(body))}
+}
+
+// retryAfter reads a Retry-After header in seconds
+func retryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
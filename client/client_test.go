@@ -0,0 +1,228 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/TeamFairmont/boltshared/security"
+	"github.com/stretchr/testify/assert"
+)
+
+type product struct {
+	Sku   string `json:"sku"`
+	Price int    `json:"price"`
+}
+
+func testConfig(tst *testing.T, authMode int) *config.Config {
+	cfg, err := config.DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	cfg.Engine.AuthMode = "hmac"
+	if authMode == config.AuthModeSimple {
+		cfg.Engine.AuthMode = "simple"
+	}
+	cfg.Security.Groups = []config.SecurityGroups{{Name: "test01", Hmackey: "01234567890~!@#$%^&*-_=+ABCabc"}}
+	return cfg
+}
+
+// newEngine returns a server that authenticates with security.Middleware, then calls handler
+func newEngine(tst *testing.T, authMode int, handler http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(security.Middleware(testConfig(tst, authMode), security.MiddlewareOptions{})(handler))
+}
+
+// getProduct answers v1/getProduct with the sku it was sent
+func getProduct(w http.ResponseWriter, r *http.Request) {
+	message, _ := security.MessageFromContext(r.Context())
+	var input map[string]string
+	json.Unmarshal([]byte(message), &input)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":           "req1",
+		"complete":     true,
+		"return_value": product{Sku: input["sku"], Price: 100},
+	})
+}
+
+func TestCall(tst *testing.T) {
+	for _, authMode := range []int{config.AuthModeHMAC, config.AuthModeSimple} {
+		var path string
+		server := newEngine(tst, authMode, func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			getProduct(w, r)
+		})
+
+		c := New(server.URL+"/", "test01", "01234567890~!@#$%^&*-_=+ABCabc")
+		c.AuthMode = authMode
+		var p product
+		resp, err := c.Call(context.Background(), "v1/getProduct", map[string]string{"sku": "123"}, &p)
+		assert.Nil(tst, err, "No error")
+		assert.Equal(tst, "/request/v1/getProduct", path, "Api call should be requested by name")
+		assert.Equal(tst, product{Sku: "123", Price: 100}, p, "Return value should be decoded")
+		assert.True(tst, resp.Complete, "Response should be complete")
+
+		c.Key = "wrong key"
+		_, err = c.Call(context.Background(), "v1/getProduct", nil, nil)
+		statusErr, ok := err.(*StatusError)
+		assert.True(tst, ok, "Should be a StatusError")
+		assert.Equal(tst, http.StatusUnauthorized, statusErr.StatusCode, "Wrong key is unauthorized")
+		server.Close()
+	}
+}
+
+func TestCallPollsForResult(tst *testing.T) {
+	var polls int32
+	server := newEngine(tst, config.AuthModeHMAC, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/request/v1/slow":
+			json.NewEncoder(w).Encode(Response{ID: "abc 1", Complete: false})
+		case r.URL.Path == "/retr/abc 1" && atomic.AddInt32(&polls, 1) < 3:
+			json.NewEncoder(w).Encode(Response{ID: "abc 1", Complete: false})
+		case r.URL.Path == "/retr/abc 1":
+			json.NewEncoder(w).Encode(Response{ID: "abc 1", Complete: true, ReturnValue: json.RawMessage(`"done"`)})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	c := New(server.URL, "test01", "01234567890~!@#$%^&*-_=+ABCabc")
+	c.PollInterval = time.Millisecond
+	var result string
+	resp, err := c.Call(context.Background(), "v1/slow", nil, &result)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, "done", result, "Polled result should be decoded")
+	assert.Equal(tst, "abc 1", resp.ID, "Response should be the final poll")
+	assert.Equal(tst, int32(3), atomic.LoadInt32(&polls), "Should poll until complete")
+
+	// Polling stops with the context
+	atomic.StoreInt32(&polls, -1000)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	resp, err = c.Call(ctx, "v1/slow", nil, &result)
+	assert.Equal(tst, context.DeadlineExceeded, err, "Should stop when the context is done")
+	assert.False(tst, resp.Complete, "Last response should be returned")
+}
+
+func TestCallRetries(tst *testing.T) {
+	var calls int32
+	server := newEngine(tst, config.AuthModeHMAC, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("engine starting"))
+			return
+		}
+		getProduct(w, r)
+	})
+	defer server.Close()
+
+	c := New(server.URL, "test01", "01234567890~!@#$%^&*-_=+ABCabc")
+	c.Backoff = Backoff{Attempts: 3, Initial: time.Millisecond, Max: 5 * time.Millisecond}
+	var p product
+	_, err := c.Call(context.Background(), "v1/getProduct", map[string]string{"sku": "9"}, &p)
+	assert.Nil(tst, err, "Third attempt should succeed, each one signed afresh")
+	assert.Equal(tst, "9", p.Sku, "Return value should be decoded")
+	assert.Equal(tst, int32(3), atomic.LoadInt32(&calls), "Should have tried three times")
+
+	atomic.StoreInt32(&calls, -10)
+	_, err = c.Call(context.Background(), "v1/getProduct", nil, nil)
+	statusErr, ok := err.(*StatusError)
+	assert.True(tst, ok, "Should be a StatusError after the last attempt")
+	assert.Equal(tst, http.StatusServiceUnavailable, statusErr.StatusCode, "Last status should be returned")
+	assert.Equal(tst, "engine starting", statusErr.Message, "Body should be the message")
+	assert.Equal(tst, int32(-7), atomic.LoadInt32(&calls), "Should stop after Attempts")
+}
+
+func TestCallRetriesOnlyUnsentRequests(tst *testing.T) {
+	var calls, polls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/request/v1/addProduct":
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path == "/request/v1/dropped":
+			atomic.AddInt32(&calls, 1)
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		case r.URL.Path == "/request/v1/slow":
+			json.NewEncoder(w).Encode(Response{ID: "abc", Complete: false})
+		case atomic.AddInt32(&polls, 1) < 2:
+			w.WriteHeader(http.StatusGatewayTimeout)
+		default:
+			json.NewEncoder(w).Encode(Response{ID: "abc", Complete: true})
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL, "test01", "01234567890~!@#$%^&*-_=+ABCabc")
+	c.Backoff = Backoff{Attempts: 3, Initial: time.Millisecond, Max: 5 * time.Millisecond}
+	c.PollInterval = time.Millisecond
+
+	_, err := c.Call(context.Background(), "v1/addProduct", nil, nil)
+	assert.Equal(tst, http.StatusBadGateway, err.(*StatusError).StatusCode, "502 should be returned")
+	assert.Equal(tst, int32(1), atomic.LoadInt32(&calls), "An api call the engine may have run isn't retried after 502")
+
+	atomic.StoreInt32(&calls, 0)
+	_, err = c.Call(context.Background(), "v1/dropped", nil, nil)
+	assert.NotNil(tst, err, "Dropped connection should be an error")
+	assert.Equal(tst, int32(1), atomic.LoadInt32(&calls), "An api call that was sent isn't retried after a network error")
+
+	resp, err := c.Call(context.Background(), "v1/slow", nil, nil)
+	assert.Nil(tst, err, "Polls should be retried after 504")
+	assert.True(tst, resp.Complete, "Response should be complete")
+	assert.Equal(tst, int32(2), atomic.LoadInt32(&polls), "Poll should have been tried twice")
+
+	// Requests that never reach the server are retried
+	var dials int32
+	c.HTTPClient = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return nil, errors.New("connection refused")
+		},
+	}}
+	_, err = c.Call(context.Background(), "v1/addProduct", nil, nil)
+	assert.NotNil(tst, err, "Unreachable server should be an error")
+	assert.Equal(tst, int32(3), atomic.LoadInt32(&dials), "Unsent requests should be retried")
+}
+
+func TestCallDefaultPollInterval(tst *testing.T) {
+	var polls int32
+	server := newEngine(tst, config.AuthModeHMAC, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, RetrievePath) {
+			atomic.AddInt32(&polls, 1)
+		}
+		json.NewEncoder(w).Encode(Response{ID: "abc", Complete: false})
+	})
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, Group: "test01", Key: "01234567890~!@#$%^&*-_=+ABCabc"}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultPollInterval/2)
+	defer cancel()
+	_, err := c.Call(ctx, "v1/slow", nil, nil)
+	assert.Equal(tst, context.DeadlineExceeded, err, "Should stop when the context is done")
+	assert.Equal(tst, int32(0), atomic.LoadInt32(&polls), "A Client without PollInterval should wait DefaultPollInterval between polls")
+}
+
+func TestBackoff(tst *testing.T) {
+	c := New("http://localhost", "test01", "key")
+	c.Backoff = Backoff{Attempts: 5, Initial: 100 * time.Millisecond, Max: 300 * time.Millisecond}
+
+	for attempt, base := range []time.Duration{100, 200, 300, 300} {
+		wait := c.backoff(attempt+1, 0)
+		base *= time.Millisecond
+		assert.True(tst, wait >= base && wait <= base+base/2, "Wait should double up to Max, plus jitter")
+	}
+	assert.Equal(tst, 2*time.Second, c.backoff(1, 2*time.Second), "A longer Retry-After should be used")
+	assert.Equal(tst, 2*time.Second, retryAfter(http.Header{"Retry-After": []string{"2"}}), "Retry-After is in seconds")
+	assert.True(tst, strings.Contains((&StatusError{StatusCode: 429, Message: "slow down"}).Error(), "429 Too Many Requests"), "Error should name the status")
+}
@@ -0,0 +1,82 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Command boltencrypt produces "enc:v1:..." values for hmackeys, keys, jwt > signingKey and cache > pass in the bolt config.
+// The secret is read from stdin so it doesn't end up in shell history.  The master key is read from
+// BOLT_MASTER_KEY, the file in BOLT_MASTER_KEY_FILE, or the -keyfile flag.  Each value only decrypts in the setting
+// named by -setting, ex: "security > groups > web > hmackey", "security > groups > web > keys > 2024-06",
+// "security > jwt > signingKey" or "cache > pass".
+// Example usage:
+//
+//	boltencrypt -genkey > /etc/bolt/master.key
+//	echo -n 'N9d*22UuzdA443Nur2eL23:a2fvTqe' | boltencrypt -keyfile /etc/bolt/master.key -setting "security > groups > web > hmackey"
+//
+// With -hash it prints an argon2id hash of the key instead, for hmackeys when engine > authMode is simple:
+//
+//	echo -n 'N9d*22UuzdA443Nur2eL23:a2fvTqe' | boltencrypt -hash
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/TeamFairmont/boltshared/security"
+)
+
+func main() {
+	genkey := flag.Bool("genkey", false, "print a new random master key and exit")
+	keyfile := flag.String("keyfile", "", "file containing the base64 master key")
+	setting := flag.String("setting", "", "the config setting the value is for, ex: \"security > groups > web > hmackey\"")
+	hash := flag.Bool("hash", false, "print an argon2id hash of the key read from stdin, for simple auth, instead of encrypting it")
+	flag.Parse()
+
+	if *genkey {
+		key, err := config.GenerateMasterKey()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(key)
+		return
+	}
+
+	secret, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && secret == "" {
+		fmt.Fprintln(os.Stderr, "No secret read from stdin")
+		os.Exit(1)
+	}
+	secret = strings.TrimRight(secret, "\r\n")
+
+	if *hash {
+		hashed, err := security.HashKey(secret)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(hashed)
+		return
+	}
+
+	if *setting == "" {
+		fmt.Fprintln(os.Stderr, "-setting is required to encrypt")
+		os.Exit(1)
+	}
+
+	masterKey, err := config.LoadMasterKey(*keyfile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	encrypted, err := config.EncryptSecret(masterKey, *setting, secret)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(encrypted)
+}
@@ -0,0 +1,193 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Builder creates a Config in code, mostly for unit tests, instead of patching TestConfigJSON.
+// Start from the defaults with NewBuilder, chain the With functions, then call Build:
+//
+//	cfg, err := config.NewBuilder().
+//		WithAPICall("v1/test", config.APICall{ResultTimeoutMs: 500, Commands: []config.CommandInfo{{Name: "test/command1"}}}).
+//		WithGroup("normal", "normal", 0).
+//		WithCommandMeta("test/command1", config.CommandMeta{}).
+//		Build()
+//
+// Build validates and normalizes the config exactly as BuildConfig does for the equivalent json.
+type Builder struct {
+	cfg *Config
+	err error
+}
+
+// NewBuilder returns a Builder starting from DefaultConfig
+func NewBuilder() *Builder {
+	cfg, err := DefaultConfig()
+	return &Builder{cfg: cfg, err: err}
+}
+
+// WithJSON overrides settings with a string of json, like CustomizeConfig
+func (b *Builder) WithJSON(custom string) *Builder {
+	if b.err == nil {
+		_, b.err = CustomizeConfig(b.cfg, custom)
+	}
+	return b
+}
+
+// With lets fn change any settings that have no With function of their own, ex: engine or cache settings
+func (b *Builder) With(fn func(cfg *Config)) *Builder {
+	if b.err == nil {
+		fn(b.cfg)
+	}
+	return b
+}
+
+// WithAPICall adds or replaces an api call
+func (b *Builder) WithAPICall(name string, call APICall) *Builder {
+	if b.err == nil {
+		if b.cfg.APICalls == nil {
+			b.cfg.APICalls = make(map[string]APICall)
+		}
+		b.cfg.APICalls[name] = call
+	}
+	return b
+}
+
+// WithCommandMeta adds or replaces the meta for a command
+func (b *Builder) WithCommandMeta(name string, meta CommandMeta) *Builder {
+	if b.err == nil {
+		if b.cfg.CommandMetas == nil {
+			b.cfg.CommandMetas = make(map[string]CommandMeta)
+		}
+		b.cfg.CommandMetas[name] = meta
+	}
+	return b
+}
+
+// WithGroup adds a security group, replacing any existing group with the same name
+func (b *Builder) WithGroup(name string, hmackey string, requestsPerSecond int64) *Builder {
+	if b.err == nil {
+		group := SecurityGroups{Name: name, Hmackey: hmackey, RequestsPerSecond: requestsPerSecond}
+		for i := range b.cfg.Security.Groups {
+			if b.cfg.Security.Groups[i].Name == name {
+				b.cfg.Security.Groups[i] = group
+				return b
+			}
+		}
+		b.cfg.Security.Groups = append(b.cfg.Security.Groups, group)
+	}
+	return b
+}
+
+// WithHandlerAccess appends a handlerAccess rule
+func (b *Builder) WithHandlerAccess(rule HandlerAccess) *Builder {
+	if b.err == nil {
+		b.cfg.Security.HandlerAccess = append(b.cfg.Security.HandlerAccess, rule)
+	}
+	return b
+}
+
+// WithFeature adds or replaces a feature flag
+func (b *Builder) WithFeature(name string, flag FeatureFlag) *Builder {
+	if b.err == nil {
+		if b.cfg.Features == nil {
+			b.cfg.Features = make(Features)
+		}
+		b.cfg.Features[name] = flag
+	}
+	return b
+}
+
+// WithWorkerConfig replaces the workerConfig branch with a string of json
+func (b *Builder) WithWorkerConfig(workerConfig string) *Builder {
+	if b.err == nil {
+		b.cfg.WorkerConfig = json.RawMessage(workerConfig)
+	}
+	return b
+}
+
+// Build returns the finished Config.  The settings are converted to json, checked against the schema,
+// loaded on top of DefaultConfig, then validated and normalized just as BuildConfig would.
+// The Builder can keep being used afterwards; later changes don't affect configs already built.
+func (b *Builder) Build() (*Config, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	raw, err := json.Marshal(b.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unset fields marshal as null, which the schema (like a hand written config) doesn't allow
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	doc = removeNulls(doc)
+	clean, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaLoader := gojsonschema.NewStringLoader(SCHEMA)
+	result, err := gojsonschema.Validate(schemaLoader, gojsonschema.NewStringLoader(string(clean)))
+	if err != nil {
+		return nil, err
+	}
+	if !result.Valid() {
+		return nil, schemaError("Invalid built config", result)
+	}
+
+	cfg, err := DefaultConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err = CustomizeConfig(cfg, string(clean))
+	if err != nil {
+		return nil, err
+	}
+	if err := finishConfig(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// removeNulls drops null values from json objects, recursively
+func removeNulls(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if child == nil {
+				delete(val, k)
+			} else {
+				val[k] = removeNulls(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = removeNulls(child)
+		}
+	}
+	return v
+}
+
+// schemaError lists the schema issues in result, in the same format BuildConfig uses
+func schemaError(title string, result *gojsonschema.Result) error {
+	var errbuf bytes.Buffer
+	errbuf.WriteString(title)
+	for _, desc := range result.Errors() {
+		errbuf.WriteString("\nJSON Schema Issue- ")
+		errbuf.WriteString(fmt.Sprintf("%s", desc))
+	}
+	errbuf.WriteString("\n")
+	return errors.New(errbuf.String())
+}
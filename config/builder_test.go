@@ -0,0 +1,89 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilder(tst *testing.T) {
+	cfg, err := NewBuilder().
+		WithAPICall("v1/test", APICall{
+			ResultTimeoutMs: 500,
+			RequiredParams:  map[string]string{"testinput": "string"},
+			Commands: []CommandInfo{
+				{Name: "test/command1", ResultTimeoutMs: 250, ConfigParams: json.RawMessage(`{"testparam": 2}`)},
+				{Name: "test/command2", ResultTimeoutMs: 500, ReturnAfter: true},
+			},
+		}).
+		WithGroup("normal", "normal", 0).
+		WithGroup("throttled", "throttled", 3).
+		WithHandlerAccess(HandlerAccess{HandlerURL: "/v1/test", DenyGroups: []string{"throttled"}}).
+		WithCommandMeta("test/command1", CommandMeta{RequiredParams: map[string]string{"testinput": "string"}}).
+		With(func(cfg *Config) { cfg.Engine.Bind = ":8888" }).
+		Build()
+	assert.Nil(tst, err, "No error")
+
+	// Derived fields are filled in
+	assert.Equal(tst, 500*time.Millisecond, cfg.APICalls["v1/test"].ResultTimeout, "Call timeout should be derived")
+	assert.Equal(tst, 250*time.Millisecond, cfg.APICalls["v1/test"].Commands[0].ResultTimeout, "Command timeout should be derived")
+	assert.Equal(tst, 2.0, cfg.APICalls["v1/test"].Commands[0].ConfigParamsObj.Path("testparam").Data(), "Config params should be parsed")
+	assert.NotNil(tst, cfg.APICalls["v1/test"].Commands[1].ConfigParamsObj, "Empty config params should be an empty object")
+	assert.NotNil(tst, cfg.WorkerConfigObj, "Worker config should be parsed")
+	assert.Equal(tst, AuthModeHMAC, cfg.Engine.AuthModeValue, "Auth mode should be derived")
+	assert.Equal(tst, int64(3), cfg.Security.Groups[1].RequestsPerSecond, "Group should be added")
+
+	// The same settings loaded from json give the same config
+	jsoncfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	jsoncfg, err = CustomizeConfig(jsoncfg, `{
+		"engine": {"bind": ":8888"},
+		"security": {
+			"groups": [{"name": "normal", "hmackey": "normal"}, {"name": "throttled", "hmackey": "throttled", "requestsPerSecond": 3}],
+			"handlerAccess": [{"handler": "/v1/test", "denyGroups": ["throttled"]}]
+		},
+		"apiCalls": {
+			"v1/test": {
+				"resultTimeoutMs": 500,
+				"requiredParams": {"testinput": "string"},
+				"commands": [
+					{"name": "test/command1", "resultTimeoutMs": 250, "configParams": {"testparam": 2}},
+					{"name": "test/command2", "resultTimeoutMs": 500, "returnAfter": true}
+				]
+			}
+		},
+		"commandMeta": {
+			"test/command1": {"requiredParams": {"testinput": "string"}}
+		}
+	}`)
+	assert.Nil(tst, err, "No error")
+	assert.Nil(tst, finishConfig(jsoncfg), "No error")
+
+	built, _ := cfg.JSON()
+	loaded, _ := jsoncfg.JSON()
+	assert.Equal(tst, loaded, built, "Builder and json should give the same config")
+	assert.Equal(tst, jsoncfg.APICalls["v1/test"].Commands[0].ResultTimeout, cfg.APICalls["v1/test"].Commands[0].ResultTimeout, "Derived fields should match")
+}
+
+func TestBuilderValidation(tst *testing.T) {
+	_, err := NewBuilder().With(func(cfg *Config) { cfg.Engine.Bind = "8888" }).Build()
+	assert.NotNil(tst, err, "Bind without a leading colon should fail the schema")
+
+	_, err = NewBuilder().WithJSON(`{"cache": {"type": "redisCluster"}}`).Build()
+	assert.NotNil(tst, err, "Semantic validation should run")
+
+	_, err = NewBuilder().WithJSON(`{not json`).WithGroup("normal", "normal", 0).Build()
+	assert.NotNil(tst, err, "The first error should be kept")
+
+	b := NewBuilder().WithGroup("normal", "normal", 0)
+	first, err := b.Build()
+	assert.Nil(tst, err, "No error")
+	b.WithGroup("normal", "changed", 0)
+	assert.Equal(tst, "normal", first.Security.Groups[0].Hmackey, "Configs already built should not change")
+}
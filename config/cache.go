@@ -0,0 +1,71 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import "errors"
+
+// Cache type constants for cache > type.  A blank type disables caching.
+const (
+	CacheTypeMemory        = "memory"
+	CacheTypeRedis         = "redis"
+	CacheTypeRedisSentinel = "redisSentinel"
+	CacheTypeRedisCluster  = "redisCluster"
+)
+
+// CacheMemoryOptions holds settings for the in-process memory cache, intended for development
+type CacheMemoryOptions struct {
+	MaxEntries        int64 `json:"maxEntries"`        // 10000, 0 for no limit
+	CleanupIntervalMs int64 `json:"cleanupIntervalMs"` // 60000, how often expired entries are removed
+}
+
+// CacheRedisOptions holds settings shared by the redis, redisSentinel and redisCluster cache types
+type CacheRedisOptions struct {
+	DB         int    `json:"db"`         // 0, ignored by redisCluster
+	PoolSize   int    `json:"poolSize"`   // 10
+	TLSEnabled bool   `json:"tlsEnabled"` // false
+	TLSCAFile  string `json:"tlsCAFile"`  // "", CA bundle used to verify the server, system roots if blank
+
+	Sentinel struct {
+		MasterName string   `json:"masterName"` // mymaster
+		Addrs      []string `json:"addrs"`      // ["sentinel1:26379", "sentinel2:26379"]
+	} `json:"sentinel"`
+
+	Cluster struct {
+		Addrs []string `json:"addrs"` // ["redis1:6379", "redis2:6379"]
+	} `json:"cluster"`
+}
+
+// CacheAddrs returns the list of addresses the cache client should connect to for the configured cache type.
+// The memory type and a disabled cache return nil.
+func (cfg *Config) CacheAddrs() []string {
+	switch cfg.Cache.Type {
+	case CacheTypeRedis:
+		return []string{cfg.Cache.Host}
+	case CacheTypeRedisSentinel:
+		return cfg.Cache.Redis.Sentinel.Addrs
+	case CacheTypeRedisCluster:
+		return cfg.Cache.Redis.Cluster.Addrs
+	}
+	return nil
+}
+
+// validateCache checks that the options required by the configured cache type are present
+func (cfg *Config) validateCache() error {
+	switch cfg.Cache.Type {
+	case "", CacheTypeMemory, CacheTypeRedis:
+		return nil
+	case CacheTypeRedisSentinel:
+		if cfg.Cache.Redis.Sentinel.MasterName == "" || len(cfg.Cache.Redis.Sentinel.Addrs) == 0 {
+			return errors.New("Invalid cache config- redisSentinel requires redis > sentinel > masterName and addrs")
+		}
+	case CacheTypeRedisCluster:
+		if len(cfg.Cache.Redis.Cluster.Addrs) == 0 {
+			return errors.New("Invalid cache config- redisCluster requires redis > cluster > addrs")
+		}
+	default:
+		return errors.New("Invalid cache config- unknown cache type " + cfg.Cache.Type)
+	}
+	return nil
+}
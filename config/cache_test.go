@@ -0,0 +1,66 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+func TestCacheAddrs(tst *testing.T) {
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	assert.Nil(tst, cfg.CacheAddrs(), "Disabled cache has no addresses")
+	assert.Nil(tst, cfg.validateCache(), "Default cache config should be valid")
+
+	cfg, err = CustomizeConfig(cfg, `{"cache": {"type": "redis"}}`)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, []string{"localhost:6379"}, cfg.CacheAddrs(), "Plain redis uses cache > host")
+
+	cfg, err = CustomizeConfig(cfg, `{"cache": {"type": "redisSentinel", "redis": {"sentinel": {"masterName": "mymaster", "addrs": ["s1:26379", "s2:26379"]}}}}`)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, []string{"s1:26379", "s2:26379"}, cfg.CacheAddrs(), "Sentinel uses the sentinel addrs")
+	assert.Nil(tst, cfg.validateCache(), "Sentinel with master name and addrs should be valid")
+	assert.Equal(tst, 10, cfg.Cache.Redis.PoolSize, "Pool size default should be kept")
+
+	cfg, err = CustomizeConfig(cfg, `{"cache": {"type": "redisCluster"}}`)
+	assert.Nil(tst, err, "No error")
+	assert.NotNil(tst, cfg.validateCache(), "Cluster without addrs should be invalid")
+
+	cfg, err = CustomizeConfig(cfg, `{"cache": {"type": "memcached"}}`)
+	assert.Nil(tst, err, "No error")
+	assert.NotNil(tst, cfg.validateCache(), "Unknown cache type should be invalid")
+}
+
+func TestCacheSchema(tst *testing.T) {
+	schemaLoader := gojsonschema.NewStringLoader(SCHEMA)
+
+	valid := []string{
+		`{"cache": {"type": "redis", "host": "localhost:6379", "keyPrefix": "dev:", "redis": {"db": 2, "tlsEnabled": true}}}`,
+		`{"cache": {"type": "memory", "memory": {"maxEntries": 100}}}`,
+		`{"cache": {"type": "redisSentinel", "redis": {"sentinel": {"masterName": "mymaster", "addrs": ["s1:26379"]}}}}`,
+		`{"cache": {"type": "redisCluster", "redis": {"cluster": {"addrs": ["r1:6379"]}}}}`,
+		`{"cache": {"timeoutMs": 500}}`,
+	}
+	for _, doc := range valid {
+		result, err := gojsonschema.Validate(schemaLoader, gojsonschema.NewStringLoader(doc))
+		assert.Nil(tst, err, "No error")
+		assert.True(tst, result.Valid(), "Should pass the schema: "+doc)
+	}
+
+	invalid := []string{
+		`{"cache": {"type": "memcached"}}`,
+		`{"cache": {"type": "redisSentinel", "redis": {"sentinel": {"addrs": ["s1:26379"]}}}}`,
+		`{"cache": {"type": "redisCluster", "redis": {"cluster": {"addrs": []}}}}`,
+		`{"cache": {"type": "redis", "redis": {"db": -1}}}`,
+	}
+	for _, doc := range invalid {
+		result, err := gojsonschema.Validate(schemaLoader, gojsonschema.NewStringLoader(doc))
+		assert.Nil(tst, err, "No error")
+		assert.False(tst, result.Valid(), "Should fail the schema: "+doc)
+	}
+}
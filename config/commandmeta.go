@@ -0,0 +1,159 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+)
+
+// IsCommandMetaTemplate reports whether a commandMeta key is a template pattern, ex: "product/*", rather than a command name.
+// Patterns use path.Match syntax, so * matches within a single segment of the command name.
+func IsCommandMetaTemplate(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// ResolveCommandMeta returns the effective CommandMeta for a command name.
+// Every template whose pattern matches the name is applied, least specific (fewest literal characters) first,
+// then the command's own entry.  Later entries override the fields of earlier ones that are non-empty or set explicitly
+// (so "noStub": false turns off a template's noStub), and requiredParams are merged key by key.  ok is false if neither a template nor an entry matches.
+func (cfg *Config) ResolveCommandMeta(name string) (meta CommandMeta, ok bool) {
+	var templates []string
+	for pattern := range cfg.CommandMetas {
+		if !IsCommandMetaTemplate(pattern) {
+			continue
+		}
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			templates = append(templates, pattern)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		li, lj := literalLength(templates[i]), literalLength(templates[j])
+		if li != lj {
+			return li < lj
+		}
+		return templates[i] < templates[j]
+	})
+
+	for _, pattern := range templates {
+		meta = mergeCommandMeta(meta, cfg.CommandMetas[pattern])
+		ok = true
+	}
+	if own, found := cfg.CommandMetas[name]; found && !IsCommandMetaTemplate(name) {
+		meta = mergeCommandMeta(meta, own)
+		ok = true
+	}
+	return meta, ok
+}
+
+// literalLength counts the characters of a pattern that aren't wildcards, as a measure of how specific it is
+func literalLength(pattern string) int {
+	return len(pattern) - strings.Count(pattern, "*") - strings.Count(pattern, "?")
+}
+
+// UnmarshalJSON decodes the entry, recording which fields were set so an explicit false or 0 can override a template
+func (m *CommandMeta) UnmarshalJSON(data []byte) error {
+	type commandMeta CommandMeta
+	meta := commandMeta(*m)
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return err
+	}
+	fields, err := decodedFields(data)
+	if err != nil {
+		return err
+	}
+	*m = CommandMeta(meta)
+	m.fields = m.fields.union(fields)
+	return nil
+}
+
+// mergeCommandMeta returns base with the fields of override applied that are non-empty or were set explicitly in json
+func mergeCommandMeta(base CommandMeta, override CommandMeta) CommandMeta {
+	set := override.fields
+	if len(override.RequiredParams) > 0 {
+		params := make(map[string]string, len(base.RequiredParams)+len(override.RequiredParams))
+		for k, v := range base.RequiredParams {
+			params[k] = v
+		}
+		for k, v := range override.RequiredParams {
+			params[k] = v
+		}
+		base.RequiredParams = params
+	}
+	if set.has("noStub") || override.NoStub {
+		base.NoStub = override.NoStub
+	}
+	if len(override.StubReturn) > 0 {
+		base.StubReturn = override.StubReturn
+	}
+	if len(override.StubData) > 0 {
+		base.StubData = override.StubData
+	}
+	if set.has("stubDelayMs") || override.StubDelayMs != 0 {
+		base.StubDelayMs = override.StubDelayMs
+	}
+	if set.has("longDescription") || override.LongDescription != "" {
+		base.LongDescription = override.LongDescription
+	}
+	if set.has("shortDescription") || override.ShortDescription != "" {
+		base.ShortDescription = override.ShortDescription
+	}
+	base.Queue = mergeQueueOptions(base.Queue, override.Queue)
+	base.fields = base.fields.union(set)
+	return base
+}
+
+// fieldSet holds the lower cased names of the json fields an object was decoded with.
+// Entries built in go rather than decoded have no fieldSet, and only their non-empty fields override.
+type fieldSet map[string]bool
+
+// decodedFields returns the fields present in a json object
+func decodedFields(data []byte) (fieldSet, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	fields := make(fieldSet, len(raw))
+	for name := range raw {
+		fields[strings.ToLower(name)] = true
+	}
+	return fields, nil
+}
+
+// has reports whether the field was present, matching names case insensitively as encoding/json does
+func (f fieldSet) has(name string) bool {
+	return f[strings.ToLower(name)]
+}
+
+// union returns the fields in either set
+func (f fieldSet) union(other fieldSet) fieldSet {
+	if len(other) == 0 {
+		return f
+	}
+	fields := make(fieldSet, len(f)+len(other))
+	for name := range f {
+		fields[name] = true
+	}
+	for name := range other {
+		fields[name] = true
+	}
+	return fields
+}
+
+// validateCommandMetas checks that every commandMeta template is a valid pattern
+func (cfg *Config) validateCommandMetas() error {
+	for name := range cfg.CommandMetas {
+		if !IsCommandMetaTemplate(name) {
+			continue
+		}
+		if _, err := path.Match(name, ""); err != nil {
+			return errors.New("Invalid commandMeta pattern " + name + "- " + err.Error())
+		}
+	}
+	return nil
+}
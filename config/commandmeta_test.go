@@ -0,0 +1,106 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+func TestResolveCommandMeta(tst *testing.T) {
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	cfg, err = CustomizeConfig(cfg, `{
+		"commandMeta": {
+			"*/*": {
+				"stubDelayMs": 50,
+				"shortDescription": "A command"
+			},
+			"product/*": {
+				"requiredParams": {"sku": "string", "name": "string"},
+				"stubDelayMs": 200,
+				"shortDescription": "A product command"
+			},
+			"product/save*": {
+				"requiredParams": {"price": "float64"}
+			},
+			"product/saveToDb": {
+				"requiredParams": {"name": "multilang-strings"},
+				"shortDescription": "Saves a product"
+			}
+		}
+	}`)
+	assert.Nil(tst, err, "No error")
+
+	meta, ok := cfg.ResolveCommandMeta("product/checkDuplicates")
+	assert.True(tst, ok, "Template should match")
+	assert.Equal(tst, map[string]string{"sku": "string", "name": "string"}, meta.RequiredParams, "Template params should be inherited")
+	assert.Equal(tst, int64(200), meta.StubDelayMs, "More specific template should override the delay")
+	assert.Equal(tst, "A product command", meta.ShortDescription, "More specific template should override the description")
+
+	meta, ok = cfg.ResolveCommandMeta("product/saveToDb")
+	assert.True(tst, ok, "Entry should match")
+	assert.Equal(tst, map[string]string{"sku": "string", "name": "multilang-strings", "price": "float64"}, meta.RequiredParams, "Params should merge with the entry winning")
+	assert.Equal(tst, "Saves a product", meta.ShortDescription, "Explicit entry should override templates")
+	assert.Equal(tst, int64(200), meta.StubDelayMs, "Unset fields should be inherited")
+
+	meta, ok = cfg.ResolveCommandMeta("order/create")
+	assert.True(tst, ok, "Catch all template should match")
+	assert.Equal(tst, int64(50), meta.StubDelayMs, "Catch all template should apply")
+
+	_, ok = cfg.ResolveCommandMeta("updateSearchIndex")
+	assert.False(tst, ok, "* should not match across segments or an empty segment")
+
+	assert.Equal(tst, 4, len(cfg.CommandMetas), "Templates stay in the raw map")
+	assert.True(tst, IsCommandMetaTemplate("product/*"), "Patterns are templates")
+	assert.False(tst, IsCommandMetaTemplate("product/saveToDb"), "Command names are not templates")
+
+	cfg.CommandMetas["product/[a"] = CommandMeta{}
+	assert.NotNil(tst, validateConfig(cfg), "Bad pattern should fail validation")
+}
+
+func TestResolveCommandMetaExplicitZero(tst *testing.T) {
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	cfg, err = CustomizeConfig(cfg, `{
+		"commandMeta": {
+			"product/*": {"noStub": true, "stubDelayMs": 200, "queue": {"lazy": true, "maxLength": 1000}},
+			"product/checkDuplicates": {"noStub": false, "stubDelayMs": 0, "queue": {"lazy": false}},
+			"product/saveToDb": {"shortDescription": "Saves a product"}
+		}
+	}`)
+	assert.Nil(tst, err, "No error")
+
+	meta, ok := cfg.ResolveCommandMeta("product/checkDuplicates")
+	assert.True(tst, ok, "Entry should match")
+	assert.False(tst, meta.NoStub, "Explicit false should turn off the template's noStub")
+	assert.Equal(tst, int64(0), meta.StubDelayMs, "Explicit 0 should turn off the template's stub delay")
+	assert.False(tst, meta.Queue.Lazy, "Explicit false should turn off the template's lazy queue")
+	assert.Equal(tst, int64(1000), meta.Queue.MaxLength, "Unset queue fields should be inherited")
+	assert.False(tst, cfg.QueueOptionsFor("product/checkDuplicates").Lazy, "Explicit false should reach the queue options")
+
+	meta, _ = cfg.ResolveCommandMeta("product/saveToDb")
+	assert.True(tst, meta.NoStub, "Unset noStub should be inherited")
+	assert.Equal(tst, int64(200), meta.StubDelayMs, "Unset stub delay should be inherited")
+	assert.True(tst, meta.Queue.Lazy, "Unset lazy should be inherited")
+}
+
+func TestCommandMetaSchema(tst *testing.T) {
+	schemaLoader := gojsonschema.NewStringLoader(SCHEMA)
+
+	result, err := gojsonschema.Validate(schemaLoader, gojsonschema.NewStringLoader(`{
+		"commandMeta": {"product/*": {"requiredParams": {"sku": "string"}, "stubDelayMs": 10}}
+	}`))
+	assert.Nil(tst, err, "No error")
+	assert.True(tst, result.Valid(), "Template entry should pass the schema")
+
+	result, err = gojsonschema.Validate(schemaLoader, gojsonschema.NewStringLoader(`{
+		"commandMeta": {"product/*": {"requiredParams": {"sku": 5}}}
+	}`))
+	assert.Nil(tst, err, "No error")
+	assert.False(tst, result.Valid(), "Required param types must be strings")
+}
@@ -18,11 +18,15 @@ func TestDefaultConfig(tst *testing.T) {
 	assert.Equal(tst, 0, len(cfg.CommandMetas), "Should be empty map")
 	assert.Nil(tst, err, "No error")
 
-	defcache := "{\"type\":\"\",\"host\":\"localhost:6379\",\"pass\":\"\",\"timeoutMs\":2000}"
+	defcache := "{\"type\":\"\",\"host\":\"localhost:6379\",\"pass\":\"\",\"timeoutMs\":2000,\"keyPrefix\":\"\"," +
+		"\"memory\":{\"maxEntries\":10000,\"cleanupIntervalMs\":60000}," +
+		"\"redis\":{\"db\":0,\"poolSize\":10,\"tlsEnabled\":false,\"tlsCAFile\":\"\",\"sentinel\":{\"masterName\":\"\",\"addrs\":[]},\"cluster\":{\"addrs\":[]}}}"
 	cac, _ := json.Marshal(cfg.Cache)
 	assert.Equal(tst, defcache, string(cac), "Cache structs should match")
 
-	defsecurity := "{\"verifyTimeout\":30,\"groups\":[],\"handlerAccess\":null,\"corsDomains\":[],\"corsAutoAddLocal\":true}"
+	defsecurity := "{\"verifyTimeout\":30,\"groups\":[],\"handlerAccess\":null,\"handlerAccessDefaultDeny\":false,\"corsDomains\":[],\"corsAutoAddLocal\":true," +
+		"\"cors\":{\"allowedOrigins\":[],\"allowedMethods\":[\"GET\",\"POST\",\"OPTIONS\"],\"allowedHeaders\":[\"Content-Type\"],\"exposedHeaders\":[],\"allowCredentials\":false,\"maxAgeSec\":0},\"masterKeyFile\":\"\"," +
+		"\"jwt\":{\"algorithm\":\"\",\"signingKey\":\"\",\"keyId\":\"\",\"issuer\":\"bolt\",\"audience\":\"\",\"lifetimeSec\":300,\"clockSkewSec\":30}}"
 	sec, _ := json.Marshal(cfg.Security)
 	assert.Equal(tst, defsecurity, string(sec), "Security structs should match")
 }
@@ -127,3 +131,46 @@ func TestBuildConfig(tst *testing.T) {
 	// An invalid path when the api is running will load the config json and schema from etc/bolt/.
 	// This path is invalid from the present working directory when running the unit tests.
 }
+
+func TestValidateHandlerAccess(tst *testing.T) {
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+
+	cfg.Security.HandlerAccess = []HandlerAccess{{Regex: "^/work/v[0-9]+/"}}
+	assert.Nil(tst, validateConfig(cfg), "A valid regex should pass")
+
+	cfg.Security.HandlerAccess = []HandlerAccess{{Regex: "^/work/v[0-9+/"}}
+	assert.NotNil(tst, validateConfig(cfg), "An invalid regex should fail")
+}
+
+func TestHandlerAccessRules(tst *testing.T) {
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+
+	cfg.Security.HandlerAccess = []HandlerAccess{{HandlerURL: "/a"}, {HandlerURL: "/b", Priority: 5}, {HandlerURL: "/c"}}
+	assert.Nil(tst, normalizeConfig(cfg), "No error")
+	rules := cfg.HandlerAccessRules()
+	assert.Equal(tst, []string{"/b", "/a", "/c"}, []string{rules[0].HandlerURL, rules[1].HandlerURL, rules[2].HandlerURL}, "Rules should be sorted by priority, then config order")
+	assert.True(tst, &rules[0] == &cfg.HandlerAccessRules()[0], "Sorted rules should be reused")
+
+	cfg.Security.HandlerAccess = []HandlerAccess{{HandlerURL: "/d"}, {HandlerURL: "/e", Priority: 1}}
+	rules = cfg.HandlerAccessRules()
+	assert.Equal(tst, "/e", rules[0].HandlerURL, "Replaced rules should be sorted again")
+}
+
+func TestValidateCors(tst *testing.T) {
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+
+	cfg.Security.Cors.AllowedOrigins = []string{"*"}
+	assert.Nil(tst, validateConfig(cfg), "Any origin without credentials should pass")
+
+	cfg.Security.Cors.AllowCredentials = true
+	assert.NotNil(tst, validateConfig(cfg), "Any origin with credentials should fail")
+
+	cfg.Security.Cors.AllowedOrigins = []string{"https://app.example.com"}
+	assert.Nil(tst, validateConfig(cfg), "Listed origins with credentials should pass")
+
+	cfg.APICalls = map[string]APICall{"v1/public": {Cors: &CorsPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}}}
+	assert.NotNil(tst, validateConfig(cfg), "An api call allowing any origin with credentials should fail")
+}
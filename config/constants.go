@@ -8,7 +8,7 @@ package config
 const ErrorQueueName = "BOLT_WORKER_ERROR"
 
 // TestConfigJSON is a barebones engine config to be used
-// by CreateTestEngine in unit tests
+// by CreateTestEngine in unit tests.  New tests can use NewBuilder instead of patching this string.
 const TestConfigJSON = `{
     "engine": {
 	  		"version": "TEST CONFIG",
@@ -0,0 +1,48 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CorsPolicy holds the CORS settings applied to requests, either globally in security > cors or per api call.
+// Origins may be exact ("https://app.example.com"), wildcard subdomains ("https://*.example.com"),
+// host only ("example.com", any scheme), or "*".  An origin pattern without a port matches any port.
+type CorsPolicy struct {
+	AllowedOrigins   []string `json:"allowedOrigins"`   // []
+	AllowedMethods   []string `json:"allowedMethods"`   // ["GET", "POST", "OPTIONS"]
+	AllowedHeaders   []string `json:"allowedHeaders"`   // ["Content-Type"]
+	ExposedHeaders   []string `json:"exposedHeaders"`   // []
+	AllowCredentials bool     `json:"allowCredentials"` // false
+	MaxAgeSec        int64    `json:"maxAgeSec"`        // 0 (don't send Access-Control-Max-Age)
+}
+
+// validateCors checks that no cors policy allows credentials from any origin, since that would let every site
+// make credentialed requests
+func (cfg *Config) validateCors() error {
+	if wildcardWithCredentials(cfg.Security.Cors) {
+		return errors.New("Invalid security config- cors can't allow credentials with allowedOrigins \"*\"")
+	}
+	for name, call := range cfg.APICalls {
+		if call.Cors != nil && wildcardWithCredentials(*call.Cors) {
+			return fmt.Errorf("Invalid apiCalls config- %s cors can't allow credentials with allowedOrigins \"*\"", name)
+		}
+	}
+	return nil
+}
+
+func wildcardWithCredentials(policy CorsPolicy) bool {
+	if !policy.AllowCredentials {
+		return false
+	}
+	for _, origin := range policy.AllowedOrigins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
+}
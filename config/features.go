@@ -0,0 +1,52 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"hash/fnv"
+
+	"github.com/TeamFairmont/boltshared/utils"
+)
+
+// Features holds the rollout flags from the features branch of the config (or features.json), keyed by flag name
+type Features map[string]FeatureFlag
+
+// FeatureFlag describes who a single feature is enabled for
+type FeatureFlag struct {
+	Enabled     bool     `json:"enabled"`               // false, master switch. If false the feature is off for everyone
+	Percentage  *int     `json:"percentage,omitempty"`  // 100 if not set, share of requests (by request id) the feature is on for
+	Groups      []string `json:"groups"`                // [] if set, the feature is only on for these security groups
+	Description string   `json:"description,omitempty"` // what the flag controls
+}
+
+// Enabled reports whether the named feature is on for a request from group with the given request id.
+// Unknown features are off.  The same name and request id always give the same answer, so every
+// part of a request sees the same result.
+func (f Features) Enabled(name string, group string, requestID string) bool {
+	flag, ok := f[name]
+	if !ok || !flag.Enabled {
+		return false
+	}
+	if len(flag.Groups) > 0 && !utils.StringInSlice(group, flag.Groups) {
+		return false
+	}
+	if flag.Percentage == nil || *flag.Percentage >= 100 {
+		return true
+	}
+	if *flag.Percentage <= 0 {
+		return false
+	}
+	return rolloutBucket(name, requestID) < *flag.Percentage
+}
+
+// rolloutBucket hashes the feature name and request id into a bucket from 0 to 99.
+// The name is included so each feature rolls out to a different set of requests.
+func rolloutBucket(name string, requestID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(requestID))
+	return int(h.Sum32() % 100)
+}
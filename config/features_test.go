@@ -0,0 +1,71 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeaturesEnabled(tst *testing.T) {
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, 0, len(cfg.Features), "Should be empty map")
+
+	cfg, err = CustomizeConfig(cfg, `{
+		"features": {
+			"on": {"enabled": true},
+			"off": {"enabled": false, "percentage": 100},
+			"admins": {"enabled": true, "groups": ["engineadmin"]},
+			"half": {"enabled": true, "percentage": 50},
+			"none": {"enabled": true, "percentage": 0}
+		}
+	}`)
+	assert.Nil(tst, err, "No error")
+
+	assert.True(tst, cfg.Features.Enabled("on", "normal", "id1"), "Enabled flag without percentage is on for everyone")
+	assert.False(tst, cfg.Features.Enabled("off", "normal", "id1"), "Disabled flag is off")
+	assert.False(tst, cfg.Features.Enabled("missing", "normal", "id1"), "Unknown flag is off")
+	assert.True(tst, cfg.Features.Enabled("admins", "engineadmin", "id1"), "Targeted group gets the flag")
+	assert.False(tst, cfg.Features.Enabled("admins", "normal", "id1"), "Other groups don't get the flag")
+	assert.False(tst, cfg.Features.Enabled("none", "normal", "id1"), "0 percent is off")
+
+	on := 0
+	for i := 0; i < 1000; i++ {
+		id := "request-" + strconv.Itoa(i)
+		result := cfg.Features.Enabled("half", "normal", id)
+		assert.Equal(tst, result, cfg.Features.Enabled("half", "other", id), "Same request id gives the same result")
+		if result {
+			on++
+		}
+	}
+	assert.True(tst, on > 400 && on < 600, "Roughly half of the requests get a 50 percent flag")
+}
+
+func TestFeaturesFile(tst *testing.T) {
+	dir, err := ioutil.TempDir("", "boltfeatures")
+	assert.Nil(tst, err, "No error")
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "features.json"), []byte(`{"newCheckout": {"enabled": true, "percentage": 10}}`), 0600)
+	assert.Nil(tst, err, "No error")
+
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	cfg.Engine.ExtraConfigFolder = dir
+	cfg, err = loadIndividualConfigs(cfg)
+	assert.Nil(tst, err, "features.json should load")
+	assert.Equal(tst, 10, *cfg.Features["newCheckout"].Percentage, "Flag should come from features.json")
+
+	err = ioutil.WriteFile(filepath.Join(dir, "features.json"), []byte(`{"newCheckout": {"enabled": true, "percentage": 150}}`), 0600)
+	assert.Nil(tst, err, "No error")
+	_, err = loadIndividualConfigs(cfg)
+	assert.NotNil(tst, err, "Percentage over 100 should fail the schema")
+}
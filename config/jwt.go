@@ -0,0 +1,48 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+)
+
+// MinJWTSecretSize is the shortest HS512 jwt signingKey accepted, since issued tokens can be attacked offline
+const MinJWTSecretSize = 32
+
+// JWTConfig holds the settings for the short-lived tokens issued by security.IssueToken, for clients such as
+// browsers that can't safely hold an hmac key
+type JWTConfig struct {
+	Algorithm    string `json:"algorithm"`    // HS512 (blank) or EdDSA
+	SigningKey   string `json:"signingKey"`   // "" (tokens disabled), an HS512 secret, a base64 Ed25519 private key or seed, or "enc:v1:..."
+	KeyID        string `json:"keyId"`        // "", sent as the kid header
+	Issuer       string `json:"issuer"`       // bolt
+	Audience     string `json:"audience"`     // "", checked when verifying if set
+	LifetimeSec  int64  `json:"lifetimeSec"`  // 300
+	ClockSkewSec int64  `json:"clockSkewSec"` // 30, leeway when checking exp, nbf and iat
+}
+
+// validateJWT checks the signing key suits the algorithm
+func (cfg *Config) validateJWT() error {
+	jwt := cfg.Security.JWT
+	if jwt.SigningKey == "" {
+		return nil
+	}
+	switch jwt.Algorithm {
+	case "", AlgHS512:
+		if len(jwt.SigningKey) < MinJWTSecretSize {
+			return errors.New("Invalid security config- jwt > signingKey must be at least 32 characters")
+		}
+	case AlgEdDSA:
+		b, err := base64.StdEncoding.DecodeString(jwt.SigningKey)
+		if err != nil || (len(b) != ed25519.SeedSize && len(b) != ed25519.PrivateKeySize) {
+			return errors.New("Invalid security config- jwt > signingKey must be a base64 Ed25519 private key or seed")
+		}
+	default:
+		return errors.New("Invalid security config- jwt > algorithm must be HS512 or EdDSA")
+	}
+	return nil
+}
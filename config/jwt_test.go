@@ -0,0 +1,23 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateJWT(tst *testing.T) {
+	cfg, _ := DefaultConfig()
+	assert.Nil(tst, cfg.validateJWT(), "Tokens are disabled by default")
+
+	cfg.Security.JWT.SigningKey = "short"
+	assert.NotNil(tst, cfg.validateJWT(), "Short HS512 key should fail")
+
+	cfg.Security.JWT.Algorithm = AlgEdDSA
+	cfg.Security.JWT.SigningKey = "11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+	assert.Nil(tst, cfg.validateJWT(), "Ed25519 seed should pass")
+}
@@ -0,0 +1,227 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Group key statuses.  Active keys sign and verify, verify-only keys are being retired and only verify,
+// and revoked keys are never used.
+const (
+	KeyStatusActive     = "active"
+	KeyStatusVerifyOnly = "verify-only"
+	KeyStatusRevoked    = "revoked"
+)
+
+// Signature algorithms for security groups and their keys, named as in JWT.  Blank means AlgHS512,
+// the algorithm used before algorithms could be chosen.
+const (
+	AlgHS256 = "HS256"
+	AlgHS512 = "HS512"
+	AlgEdDSA = "EdDSA" // Ed25519; the config holds only the client's base64 public key
+)
+
+// GroupKey is one of a security group's keys, identified by ID (the kid in encoded messages).
+// Keys let a group be rotated without downtime: add the new key, move clients to it, mark the old key
+// verify-only, then revoke or remove it.
+type GroupKey struct {
+	ID        string     `json:"id"`        // 2024-01
+	Key       string     `json:"key"`       // N9d*22UuzdA443Nur2eL23:a2fvTqe, "enc:v1:..." from EncryptSecret, or a base64 public key for EdDSA
+	NotBefore *time.Time `json:"notBefore"` // RFC 3339, ex: 2024-01-01T00:00:00Z.  Unset means no start.
+	NotAfter  *time.Time `json:"notAfter"`  // RFC 3339.  Unset means no expiry.
+	Status    string     `json:"status"`    // active (or blank), verify-only, revoked
+	Algorithm string     `json:"algorithm"` // blank to use the group's algorithm
+}
+
+// ValidAt reports whether now is within the key's notBefore/notAfter window
+func (k GroupKey) ValidAt(now time.Time) bool {
+	if k.NotBefore != nil && now.Before(*k.NotBefore) {
+		return false
+	}
+	if k.NotAfter != nil && !now.Before(*k.NotAfter) {
+		return false
+	}
+	return true
+}
+
+// CanSign reports whether the key may sign messages at now
+func (k GroupKey) CanSign(now time.Time) bool {
+	return (k.Status == "" || k.Status == KeyStatusActive) && k.ValidAt(now)
+}
+
+// CanVerify reports whether the key may verify messages at now
+func (k GroupKey) CanVerify(now time.Time) bool {
+	return k.Status != KeyStatusRevoked && k.ValidAt(now)
+}
+
+// SigningKey returns the key to sign with at now: the active key with the latest notBefore, or the
+// group's hmackey (with a blank ID) if it has no keys.  ok is false if no key can sign.
+// The key's Algorithm is always set, from the group if the key doesn't have its own.
+func (g SecurityGroups) SigningKey(now time.Time) (key GroupKey, ok bool) {
+	if len(g.Keys) == 0 {
+		return GroupKey{Key: g.Hmackey, Algorithm: g.algorithm()}, g.Hmackey != ""
+	}
+	for _, k := range g.Keys {
+		if !k.CanSign(now) {
+			continue
+		}
+		if !ok || startOf(k).After(startOf(key)) {
+			key, ok = k, true
+		}
+	}
+	key.Algorithm = g.keyAlgorithm(key)
+	return key, ok
+}
+
+// VerifyKeys returns every key that may verify messages at now, plus the group's hmackey (with a blank ID) if set.
+// Each key's Algorithm is always set, from the group if the key doesn't have its own.
+func (g SecurityGroups) VerifyKeys(now time.Time) []GroupKey {
+	var keys []GroupKey
+	for _, k := range g.AllKeys() {
+		if k.CanVerify(now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// AllKeys returns every key, including revoked keys and keys outside their window, plus the group's hmackey
+// (with a blank ID) if set.  Each key's Algorithm is always set, from the group if the key doesn't have its own.
+func (g SecurityGroups) AllKeys() []GroupKey {
+	keys := make([]GroupKey, 0, len(g.Keys)+1)
+	for _, k := range g.Keys {
+		k.Algorithm = g.keyAlgorithm(k)
+		keys = append(keys, k)
+	}
+	if g.Hmackey != "" {
+		keys = append(keys, GroupKey{Key: g.Hmackey, Algorithm: g.algorithm()})
+	}
+	return keys
+}
+
+// algorithm returns the group's signature algorithm, AlgHS512 if blank
+func (g SecurityGroups) algorithm() string {
+	if g.Algorithm == "" {
+		return AlgHS512
+	}
+	return g.Algorithm
+}
+
+// keyAlgorithm returns k's signature algorithm, the group's if blank
+func (g SecurityGroups) keyAlgorithm(k GroupKey) string {
+	if k.Algorithm == "" {
+		return g.algorithm()
+	}
+	return k.Algorithm
+}
+
+func startOf(k GroupKey) time.Time {
+	if k.NotBefore == nil {
+		return time.Time{}
+	}
+	return *k.NotBefore
+}
+
+// ExpiringKey identifies a group key that expires soon, from ExpiringKeys
+type ExpiringKey struct {
+	Group    string
+	ID       string
+	Status   string
+	NotAfter time.Time
+}
+
+// ExpiringKeys returns the keys that aren't revoked and whose notAfter falls within the next period after now,
+// soonest first, so they can be logged or alerted on before clients start failing
+func (cfg *Config) ExpiringKeys(now time.Time, within time.Duration) []ExpiringKey {
+	var expiring []ExpiringKey
+	for _, g := range cfg.Security.Groups {
+		for _, k := range g.Keys {
+			if k.Status == KeyStatusRevoked || k.NotAfter == nil {
+				continue
+			}
+			if !k.NotAfter.Before(now) && !k.NotAfter.After(now.Add(within)) {
+				expiring = append(expiring, ExpiringKey{Group: g.Name, ID: k.ID, Status: k.Status, NotAfter: *k.NotAfter})
+			}
+		}
+	}
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].NotAfter.Before(expiring[j].NotAfter)
+	})
+	return expiring
+}
+
+// validateGroupKeys checks that every group key has a unique id, a key, and a notBefore earlier than its notAfter,
+// and that EdDSA hmackeys and keys are base64 Ed25519 public keys
+func (cfg *Config) validateGroupKeys() error {
+	for _, g := range cfg.Security.Groups {
+		if g.Hmackey != "" && g.algorithm() == AlgEdDSA && !isEd25519PublicKey(g.Hmackey) {
+			return errors.New("Invalid security config- group " + g.Name + " hmackey must be a base64 Ed25519 public key")
+		}
+
+		ids := make(map[string]bool)
+		for _, k := range g.Keys {
+			if k.ID == "" || k.Key == "" {
+				return errors.New("Invalid security config- group " + g.Name + " has a key without an id or key")
+			}
+			if ids[k.ID] {
+				return errors.New("Invalid security config- group " + g.Name + " has more than one key with id " + k.ID)
+			}
+			ids[k.ID] = true
+			if k.NotBefore != nil && k.NotAfter != nil && !k.NotBefore.Before(*k.NotAfter) {
+				return errors.New("Invalid security config- group " + g.Name + " key " + k.ID + " notBefore must be earlier than notAfter")
+			}
+			if g.keyAlgorithm(k) == AlgEdDSA && !isEd25519PublicKey(k.Key) {
+				return errors.New("Invalid security config- group " + g.Name + " key " + k.ID + " must be a base64 Ed25519 public key")
+			}
+		}
+	}
+	return nil
+}
+
+// IsHashedKey reports whether key is an argon2id or bcrypt hash (from security.HashKey or HashKeyBcrypt) rather than the key itself
+func IsHashedKey(key string) bool {
+	for _, prefix := range []string{"$argon2id$", "$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateHashedKeys checks hashed keys are only used with simple auth, which compares the key the client sends.
+// With simple auth, groups still storing the plaintext key get a deprecation warning.
+func (cfg *Config) validateHashedKeys() error {
+	simple := strings.ToLower(cfg.Engine.AuthMode) == "simple"
+	for _, g := range cfg.Security.Groups {
+		keys := []string{g.Hmackey}
+		for _, k := range g.Keys {
+			keys = append(keys, k.Key)
+		}
+		for _, key := range keys {
+			if key == "" || g.algorithm() == AlgEdDSA {
+				continue
+			}
+			if IsHashedKey(key) && !simple {
+				return errors.New("Invalid security config- group " + g.Name + " has a hashed key, which only works with engine > authMode simple")
+			}
+			if !IsHashedKey(key) && simple {
+				cfg.Warnings = append(cfg.Warnings, "Deprecated security config- group "+g.Name+" stores its key in plaintext; replace it with a hash from security.HashKey")
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func isEd25519PublicKey(key string) bool {
+	b, err := base64.StdEncoding.DecodeString(key)
+	return err == nil && len(b) == ed25519.PublicKeySize
+}
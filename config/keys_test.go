@@ -0,0 +1,110 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupKeys(tst *testing.T) {
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	cfg, err = CustomizeConfig(cfg, `{
+		"security": {
+			"groups": [
+				{
+					"name": "rotating",
+					"keys": [
+						{"id": "2024-01", "key": "oldkey", "notAfter": "2024-07-01T00:00:00Z", "status": "verify-only"},
+						{"id": "2024-06", "key": "newkey", "notBefore": "2024-06-01T00:00:00Z", "notAfter": "2025-01-01T00:00:00Z"},
+						{"id": "2023-01", "key": "leaked", "status": "revoked"}
+					]
+				},
+				{
+					"name": "legacy",
+					"hmackey": "legacykey"
+				}
+			]
+		}
+	}`)
+	assert.Nil(tst, err, "No error")
+	assert.Nil(tst, validateConfig(cfg), "Keys should be valid")
+
+	rotating := cfg.Security.Groups[0]
+	june := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	key, ok := rotating.SigningKey(june)
+	assert.True(tst, ok, "A key can sign")
+	assert.Equal(tst, "2024-06", key.ID, "The newest active key signs")
+
+	var ids []string
+	for _, k := range rotating.VerifyKeys(june) {
+		ids = append(ids, k.ID)
+	}
+	assert.Equal(tst, []string{"2024-01", "2024-06"}, ids, "Verify-only and active keys verify, revoked keys don't")
+	assert.Len(tst, rotating.AllKeys(), 3, "AllKeys includes revoked keys")
+	assert.Equal(tst, []GroupKey{{Key: "legacykey", Algorithm: AlgHS512}}, cfg.Security.Groups[1].AllKeys(), "AllKeys includes the hmackey")
+
+	_, ok = rotating.SigningKey(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC))
+	assert.False(tst, ok, "No key can sign after every key expires")
+
+	key, ok = cfg.Security.Groups[1].SigningKey(june)
+	assert.True(tst, ok, "hmackey signs for groups without keys")
+	assert.Equal(tst, GroupKey{Key: "legacykey", Algorithm: AlgHS512}, key, "hmackey has a blank id and the default algorithm")
+
+	expiring := cfg.ExpiringKeys(june, 30*24*time.Hour)
+	assert.Equal(tst, []ExpiringKey{{Group: "rotating", ID: "2024-01", Status: KeyStatusVerifyOnly, NotAfter: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)}}, expiring, "Only the key expiring within 30 days is reported")
+	assert.Len(tst, cfg.ExpiringKeys(june, 365*24*time.Hour), 2, "Both dated keys expire within a year")
+}
+
+func TestValidateGroupKeys(tst *testing.T) {
+	cfg, _ := DefaultConfig()
+	cfg, err := CustomizeConfig(cfg, `{"security": {"groups": [{"name": "g", "keys": [{"id": "a", "key": "1"}, {"id": "a", "key": "2"}]}]}}`)
+	assert.Nil(tst, err, "No error")
+	assert.NotNil(tst, validateConfig(cfg), "Duplicate key ids should fail")
+
+	cfg, _ = DefaultConfig()
+	cfg, err = CustomizeConfig(cfg, `{"security": {"groups": [{"name": "g", "keys": [{"id": "a", "key": "1", "notBefore": "2024-02-01T00:00:00Z", "notAfter": "2024-01-01T00:00:00Z"}]}]}}`)
+	assert.Nil(tst, err, "No error")
+	assert.NotNil(tst, validateConfig(cfg), "A window that ends before it starts should fail")
+}
+
+func TestGroupKeyAlgorithms(tst *testing.T) {
+	cfg, _ := DefaultConfig()
+	cfg, err := CustomizeConfig(cfg, `{"security": {"groups": [{"name": "partner", "algorithm": "EdDSA", "keys": [
+		{"id": "ed", "key": "11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="},
+		{"id": "hs", "key": "secret", "algorithm": "HS256"}
+	]}]}}`)
+	assert.Nil(tst, err, "No error")
+	assert.Nil(tst, validateConfig(cfg), "Keys should be valid")
+
+	keys := cfg.Security.Groups[0].VerifyKeys(time.Now())
+	assert.Equal(tst, AlgEdDSA, keys[0].Algorithm, "Keys use the group's algorithm by default")
+	assert.Equal(tst, AlgHS256, keys[1].Algorithm, "Keys can override the algorithm")
+
+	cfg, _ = DefaultConfig()
+	cfg, err = CustomizeConfig(cfg, `{"security": {"groups": [{"name": "partner", "algorithm": "EdDSA", "hmackey": "not a public key"}]}}`)
+	assert.Nil(tst, err, "No error")
+	assert.NotNil(tst, validateConfig(cfg), "EdDSA hmackey must be a public key")
+}
+
+func TestValidateHashedKeys(tst *testing.T) {
+	hash := "$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHRzYWx0c2FsdA$aGFzaGhhc2hoYXNoaGFzaGhhc2hoYXNoaGFzaGhhc2g"
+
+	cfg, _ := DefaultConfig()
+	cfg, err := CustomizeConfig(cfg, `{"engine": {"authMode": "simple"}, "security": {"groups": [{"name": "a", "hmackey": "`+hash+`"}, {"name": "b", "hmackey": "plain"}]}}`)
+	assert.Nil(tst, err, "No error")
+	assert.Nil(tst, validateConfig(cfg), "Hashed and plaintext keys are allowed with simple auth")
+	assert.Equal(tst, []string{"Deprecated security config- group b stores its key in plaintext; replace it with a hash from security.HashKey"}, cfg.Warnings, "Plaintext key should be warned about")
+
+	cfg, _ = DefaultConfig()
+	cfg, err = CustomizeConfig(cfg, `{"security": {"groups": [{"name": "a", "hmackey": "`+hash+`"}]}}`)
+	assert.Nil(tst, err, "No error")
+	assert.NotNil(tst, validateConfig(cfg), "Hashed keys can't sign hmac messages")
+	assert.Empty(tst, cfg.Warnings, "Plaintext keys are expected with hmac auth")
+}
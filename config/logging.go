@@ -0,0 +1,154 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"errors"
+	"strings"
+)
+
+// LogLevels lists the valid logging levels, from most to least verbose
+var LogLevels = []string{"debug", "info", "warn", "error", "fatal", "panic"}
+
+// Log sink output formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LogSink is a single logging destination with its own level, format and options
+type LogSink struct {
+	Type       string            `json:"type"`       // fs, syslog, mongodb (or add more in bolt/logging.go)
+	Level      string            `json:"level"`      // debug, info, warn, error, fatal, panic.  Blank uses logging > level
+	Format     string            `json:"format"`     // text (default) or json
+	Components map[string]string `json:"components"` // per-component level overrides for this sink, ex: {"cache": "debug"}
+	Options    LogSinkOptions    `json:"options"`
+}
+
+// LogSinkOptions holds the type specific settings of a LogSink.  Only the fields for the sink's type are used.
+type LogSinkOptions struct {
+	//fs options
+	Path       string            `json:"path"`       // /var/log/bolt/bolt.log, receives every entry at or above the sink level
+	LevelPaths map[string]string `json:"levelPaths"` // {"error": "/var/log/bolt/error.log"}, overrides path for the given level
+
+	//syslog options
+	Protocol string `json:"protocol"` //udp
+
+	//syslog and mongodb options
+	IPPort string `json:"ipPort"` //localhost:445
+
+	//mongodb options
+	Db         string `json:"db"`         //db
+	Collection string `json:"collection"` //collection
+}
+
+// LogLevelRank returns the position of level within LogLevels, or -1 if it isn't a valid level
+func LogLevelRank(level string) int {
+	for i, l := range LogLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// ParseLogLevel normalizes a logging > level value.  Older configs may use any case, "warning" for warn,
+// or leave the level blank, which uses info.
+func ParseLogLevel(level string) (string, error) {
+	level = strings.ToLower(strings.TrimSpace(level))
+	switch level {
+	case "":
+		return "info", nil
+	case "warning":
+		return "warn", nil
+	}
+	if LogLevelRank(level) < 0 {
+		return "", errors.New("Invalid logging config- unknown level " + level)
+	}
+	return level, nil
+}
+
+// ComponentLevel returns the sink's level for a component, taking component overrides into account
+func (s LogSink) ComponentLevel(component string) string {
+	if level, ok := s.Components[component]; ok && level != "" {
+		return level
+	}
+	return s.Level
+}
+
+// Enabled reports whether an entry of the given level from component should be written to this sink
+func (s LogSink) Enabled(component, level string) bool {
+	threshold := LogLevelRank(s.ComponentLevel(component))
+	rank := LogLevelRank(level)
+	return rank >= 0 && threshold >= 0 && rank >= threshold
+}
+
+// LogSinks returns the effective list of log sinks.
+// When logging > sinks is empty, the flat type/level/fs/syslog/mongo fields are converted into a single sink
+// so older configs keep working.  Blank sink levels and formats are filled from logging > level and text.
+func (cfg *Config) LogSinks() []LogSink {
+	var sinks []LogSink
+	if len(cfg.Logging.Sinks) > 0 {
+		sinks = make([]LogSink, len(cfg.Logging.Sinks))
+		copy(sinks, cfg.Logging.Sinks)
+	} else {
+		sinks = []LogSink{cfg.legacyLogSink()}
+	}
+
+	for i := range sinks {
+		if sinks[i].Level == "" {
+			sinks[i].Level = cfg.Logging.Level
+		}
+		if sinks[i].Format == "" {
+			sinks[i].Format = LogFormatText
+		}
+		// Global component overrides apply unless the sink sets its own for that component
+		for component, level := range cfg.Logging.Components {
+			if _, ok := sinks[i].Components[component]; !ok {
+				if sinks[i].Components == nil {
+					sinks[i].Components = make(map[string]string)
+				}
+				sinks[i].Components[component] = level
+			}
+		}
+	}
+	return sinks
+}
+
+// legacyLogSink builds a sink from the flat logging fields used before logging > sinks existed
+func (cfg *Config) legacyLogSink() LogSink {
+	sink := LogSink{
+		Type:  cfg.Logging.Type,
+		Level: cfg.Logging.Level,
+	}
+
+	switch cfg.Logging.Type {
+	case "fs":
+		paths := map[string]string{
+			"debug": cfg.Logging.FsDebugPath,
+			"info":  cfg.Logging.FsInfoPath,
+			"warn":  cfg.Logging.FsWarnPath,
+			"error": cfg.Logging.FsErrorPath,
+			"fatal": cfg.Logging.FsFatalPath,
+			"panic": cfg.Logging.FsPanicPath,
+		}
+		for level, path := range paths {
+			if path != "" {
+				if sink.Options.LevelPaths == nil {
+					sink.Options.LevelPaths = make(map[string]string)
+				}
+				sink.Options.LevelPaths[level] = path
+			}
+		}
+	case "syslog":
+		sink.Options.Protocol = cfg.Logging.SyslogProtocol
+		sink.Options.IPPort = cfg.Logging.SyslogIPPort
+	case "mongodb":
+		sink.Options.IPPort = cfg.Logging.MongoIPPort
+		sink.Options.Db = cfg.Logging.MongoDb
+		sink.Options.Collection = cfg.Logging.MongoCollection
+	}
+	return sink
+}
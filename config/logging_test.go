@@ -0,0 +1,126 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+func TestLogSinksLegacy(tst *testing.T) {
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+
+	cfg, err = CustomizeConfig(cfg, `{
+		"logging": {
+			"type": "fs",
+			"level": "warn",
+			"fsErrorPath": "/tmp/error.log",
+			"fsWarnPath": "/tmp/warn.log",
+			"components": {"cache": "debug"}
+		}
+	}`)
+	assert.Nil(tst, err, "No error")
+
+	sinks := cfg.LogSinks()
+	assert.Equal(tst, 1, len(sinks), "Flat logging fields should become a single sink")
+	assert.Equal(tst, "fs", sinks[0].Type, "Sink type should come from logging > type")
+	assert.Equal(tst, "warn", sinks[0].Level, "Sink level should come from logging > level")
+	assert.Equal(tst, LogFormatText, sinks[0].Format, "Sink format should default to text")
+	assert.Equal(tst, "/tmp/error.log", sinks[0].Options.LevelPaths["error"], "fsErrorPath should map to the error level path")
+	assert.Equal(tst, 2, len(sinks[0].Options.LevelPaths), "Only non-blank fs paths should be mapped")
+	assert.True(tst, sinks[0].Enabled("cache", "debug"), "Cache component override should enable debug")
+	assert.False(tst, sinks[0].Enabled("engine", "info"), "Other components should use the sink level")
+}
+
+func TestLogSinks(tst *testing.T) {
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+
+	cfg, err = CustomizeConfig(cfg, `{
+		"logging": {
+			"level": "info",
+			"sinks": [{
+				"type": "syslog",
+				"level": "error",
+				"format": "json",
+				"options": {"protocol": "udp", "ipPort": "localhost:514"}
+			}, {
+				"type": "fs",
+				"components": {"cache": "debug"},
+				"options": {"path": "/var/log/bolt/bolt.log"}
+			}]
+		}
+	}`)
+	assert.Nil(tst, err, "No error")
+
+	sinks := cfg.LogSinks()
+	assert.Equal(tst, 2, len(sinks), "Both sinks should be returned")
+	assert.Equal(tst, LogFormatJSON, sinks[0].Format, "Syslog sink should keep its json format")
+	assert.True(tst, sinks[0].Enabled("engine", "error"), "Errors should go to syslog")
+	assert.False(tst, sinks[0].Enabled("cache", "debug"), "Cache debug should not go to syslog")
+	assert.Equal(tst, "info", sinks[1].Level, "Blank sink level should use logging > level")
+	assert.True(tst, sinks[1].Enabled("cache", "debug"), "Cache debug should go to the file")
+	assert.False(tst, sinks[1].Enabled("engine", "debug"), "Engine debug should not go to the file")
+	assert.False(tst, sinks[1].Enabled("engine", "verbose"), "Unknown levels are never enabled")
+}
+
+func TestLogLevelLegacy(tst *testing.T) {
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+
+	cfg, err = CustomizeConfig(cfg, `{"logging": {"type": "fs", "level": "WARNING"}}`)
+	assert.Nil(tst, err, "No error")
+	assert.Nil(tst, normalizeConfig(cfg), "Legacy level should normalize")
+	assert.Equal(tst, "warn", cfg.Logging.Level, "WARNING should become warn")
+
+	cfg.Logging.Level = ""
+	assert.Nil(tst, normalizeConfig(cfg), "Blank level should normalize")
+	assert.Equal(tst, "info", cfg.Logging.Level, "Blank level should use info")
+	assert.True(tst, cfg.LogSinks()[0].Enabled("engine", "info"), "Blank level should still log info")
+
+	cfg.Logging.Level = "DEBUG"
+	assert.Nil(tst, normalizeConfig(cfg), "Upper case level should normalize")
+	assert.Equal(tst, "debug", cfg.Logging.Level, "DEBUG should become debug")
+
+	cfg.Logging.Level = "verbose"
+	assert.NotNil(tst, normalizeConfig(cfg), "Unknown level should be an error")
+
+	result, err := gojsonschema.Validate(gojsonschema.NewStringLoader(SCHEMA), gojsonschema.NewStringLoader(`{
+		"logging": {"level": ""}
+	}`))
+	assert.Nil(tst, err, "No error")
+	assert.True(tst, result.Valid(), "Blank logging > level should pass the schema")
+}
+
+func TestLoggingSchema(tst *testing.T) {
+	schemaLoader := gojsonschema.NewStringLoader(SCHEMA)
+
+	result, err := gojsonschema.Validate(schemaLoader, gojsonschema.NewStringLoader(`{
+		"logging": {"level": "warn", "components": {"cache": "debug"}, "sinks": [{"type": "fs", "level": "info", "format": "text"}]}
+	}`))
+	assert.Nil(tst, err, "No error")
+	assert.True(tst, result.Valid(), "Valid logging config should pass the schema")
+
+	result, err = gojsonschema.Validate(schemaLoader, gojsonschema.NewStringLoader(`{
+		"logging": {"sinks": [{"type": "fs", "level": "verbose"}]}
+	}`))
+	assert.Nil(tst, err, "No error")
+	assert.False(tst, result.Valid(), "Unknown sink level should fail the schema")
+
+	result, err = gojsonschema.Validate(schemaLoader, gojsonschema.NewStringLoader(`{
+		"logging": {"components": {"cache": "loud"}}
+	}`))
+	assert.Nil(tst, err, "No error")
+	assert.False(tst, result.Valid(), "Unknown component level should fail the schema")
+
+	result, err = gojsonschema.Validate(schemaLoader, gojsonschema.NewStringLoader(`{
+		"logging": {"sinks": [{"type": "fs", "format": "xml"}]}
+	}`))
+	assert.Nil(tst, err, "No error")
+	assert.False(tst, result.Valid(), "Unknown sink format should fail the schema")
+}
@@ -0,0 +1,41 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+// MQ url policy constants for engine > mq > urlPolicy
+const (
+	MQURLPolicyOrdered = "ordered"
+	MQURLPolicyRandom  = "random"
+)
+
+// MQConfig holds the list of brokers to connect to and the amqp connection tuning settings
+type MQConfig struct {
+	URLs                []string   `json:"urls"`                // [] failover list of amqp urls. If empty, engine > mqUrl is used
+	URLPolicy           string     `json:"urlPolicy"`           // ordered (try urls first to last) or random (shuffle urls on every attempt)
+	HeartbeatMs         int64      `json:"heartbeatMs"`         // 10000
+	ConnectionTimeoutMs int64      `json:"connectionTimeoutMs"` // 30000
+	ChannelMax          int        `json:"channelMax"`          // 0 (use the server's limit)
+	FrameSize           int        `json:"frameSize"`           // 0 (use the server's limit)
+	TLS                 TLSOptions `json:"tls"`                 // used for amqps urls
+
+	ReconnectBackoff struct {
+		InitialMs   int64   `json:"initialMs"`   // 500, wait before the second pass through the url list
+		MaxMs       int64   `json:"maxMs"`       // 30000, upper limit on the wait between passes
+		Multiplier  float64 `json:"multiplier"`  // 2, growth of the wait after each failed pass
+		MaxAttempts int     `json:"maxAttempts"` // 1, passes through the url list before giving up. 0 retries forever
+	} `json:"reconnectBackoff"`
+}
+
+// MQSettings returns engine > mq, using engine > mqUrl as the only broker when no urls are listed
+func (cfg *Config) MQSettings() MQConfig {
+	mq := cfg.Engine.MQ
+	if len(mq.URLs) == 0 && cfg.Engine.MQUrl != "" {
+		mq.URLs = []string{cfg.Engine.MQUrl}
+	}
+	if mq.URLPolicy == "" {
+		mq.URLPolicy = MQURLPolicyOrdered
+	}
+	return mq
+}
@@ -0,0 +1,83 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import "encoding/json"
+
+// Queue overflow constants for QueueOptions.Overflow
+const (
+	QueueOverflowDropHead         = "drop-head"
+	QueueOverflowRejectPublish    = "reject-publish"
+	QueueOverflowRejectPublishDLX = "reject-publish-dlx"
+)
+
+// QueueOptions describes the topology of a command's queue.  Zero values leave the broker's default in place.
+// Engine wide defaults are set in engine > advanced > queue, and commandMeta > queue overrides them per command.
+// Changing these for a queue that already exists requires deleting the queue first, as the broker won't redeclare it.
+type QueueOptions struct {
+	MessageTTLMs         int64  `json:"messageTtlMs"`         // 0, x-message-ttl
+	MaxLength            int64  `json:"maxLength"`            // 0, x-max-length
+	Overflow             string `json:"overflow"`             // "" (drop-head), reject-publish or reject-publish-dlx. x-overflow
+	DeadLetterExchange   string `json:"deadLetterExchange"`   // "", x-dead-letter-exchange
+	DeadLetterRoutingKey string `json:"deadLetterRoutingKey"` // "", x-dead-letter-routing-key. With no exchange, the queue of this name on the default exchange
+	MaxPriority          int64  `json:"maxPriority"`          // 0, x-max-priority (1 to 255 enables priorities)
+	Lazy                 bool   `json:"lazy"`                 // false, x-queue-mode lazy keeps messages on disk
+
+	fields fieldSet // json fields the options were decoded with, see mergeQueueOptions
+}
+
+// UnmarshalJSON decodes the options, recording which fields were set so an explicit false or 0 can override a default
+func (q *QueueOptions) UnmarshalJSON(data []byte) error {
+	type queueOptions QueueOptions
+	opts := queueOptions(*q)
+	if err := json.Unmarshal(data, &opts); err != nil {
+		return err
+	}
+	fields, err := decodedFields(data)
+	if err != nil {
+		return err
+	}
+	*q = QueueOptions(opts)
+	q.fields = q.fields.union(fields)
+	return nil
+}
+
+// QueueOptionsFor returns the queue options for a command: engine > advanced > queue, overridden by the
+// non-empty fields of the command's effective commandMeta > queue (see ResolveCommandMeta).
+func (cfg *Config) QueueOptionsFor(command string) QueueOptions {
+	opts := cfg.Engine.Advanced.Queue
+	if meta, ok := cfg.ResolveCommandMeta(command); ok {
+		opts = mergeQueueOptions(opts, meta.Queue)
+	}
+	return opts
+}
+
+// mergeQueueOptions returns base with the fields of override applied that are non-empty or were set explicitly in json
+func mergeQueueOptions(base QueueOptions, override QueueOptions) QueueOptions {
+	set := override.fields
+	if set.has("messageTtlMs") || override.MessageTTLMs != 0 {
+		base.MessageTTLMs = override.MessageTTLMs
+	}
+	if set.has("maxLength") || override.MaxLength != 0 {
+		base.MaxLength = override.MaxLength
+	}
+	if set.has("overflow") || override.Overflow != "" {
+		base.Overflow = override.Overflow
+	}
+	if set.has("deadLetterExchange") || override.DeadLetterExchange != "" {
+		base.DeadLetterExchange = override.DeadLetterExchange
+	}
+	if set.has("deadLetterRoutingKey") || override.DeadLetterRoutingKey != "" {
+		base.DeadLetterRoutingKey = override.DeadLetterRoutingKey
+	}
+	if set.has("maxPriority") || override.MaxPriority != 0 {
+		base.MaxPriority = override.MaxPriority
+	}
+	if set.has("lazy") || override.Lazy {
+		base.Lazy = override.Lazy
+	}
+	base.fields = base.fields.union(set)
+	return base
+}
@@ -0,0 +1,78 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+func TestQueueOptionsFor(tst *testing.T) {
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	cfg, err = CustomizeConfig(cfg, `{
+		"engine": {"advanced": {"queue": {"messageTtlMs": 60000, "deadLetterRoutingKey": "BOLT_DEAD_LETTER"}}},
+		"commandMeta": {
+			"product/*": {"queue": {"maxLength": 1000, "overflow": "reject-publish"}},
+			"product/reindex": {"queue": {"messageTtlMs": 600000, "lazy": true}}
+		}
+	}`)
+	assert.Nil(tst, err, "No error")
+
+	opts := cfg.QueueOptionsFor("order/create")
+	assert.Equal(tst, int64(60000), opts.MessageTTLMs, "Engine default TTL applies")
+	assert.Equal(tst, "BOLT_DEAD_LETTER", opts.DeadLetterRoutingKey, "Engine default dead letter applies")
+	assert.Equal(tst, int64(0), opts.MaxLength, "No max length by default")
+
+	opts = cfg.QueueOptionsFor("product/reindex")
+	assert.Equal(tst, int64(600000), opts.MessageTTLMs, "Command TTL overrides the default")
+	assert.Equal(tst, int64(1000), opts.MaxLength, "Template max length is inherited")
+	assert.Equal(tst, QueueOverflowRejectPublish, opts.Overflow, "Template overflow is inherited")
+	assert.True(tst, opts.Lazy, "Command lazy mode applies")
+	assert.Equal(tst, "BOLT_DEAD_LETTER", opts.DeadLetterRoutingKey, "Engine default dead letter still applies")
+}
+
+func TestQueueOptionsForExplicitZero(tst *testing.T) {
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	cfg, err = CustomizeConfig(cfg, `{
+		"engine": {"advanced": {"queue": {"messageTtlMs": 60000, "lazy": true}}},
+		"commandMeta": {"order/create": {"queue": {"messageTtlMs": 0, "lazy": false}}}
+	}`)
+	assert.Nil(tst, err, "No error")
+
+	opts := cfg.QueueOptionsFor("order/create")
+	assert.Equal(tst, int64(0), opts.MessageTTLMs, "Explicit 0 should turn off the default TTL")
+	assert.False(tst, opts.Lazy, "Explicit false should turn off the default lazy mode")
+
+	opts = cfg.QueueOptionsFor("order/cancel")
+	assert.Equal(tst, int64(60000), opts.MessageTTLMs, "Engine default TTL applies")
+	assert.True(tst, opts.Lazy, "Engine default lazy mode applies")
+}
+
+func TestQueueSchema(tst *testing.T) {
+	schemaLoader := gojsonschema.NewStringLoader(SCHEMA)
+
+	result, err := gojsonschema.Validate(schemaLoader, gojsonschema.NewStringLoader(`{
+		"engine": {"advanced": {"queue": {"messageTtlMs": 1000, "lazy": true}}},
+		"commandMeta": {"a/b": {"queue": {"maxPriority": 10, "overflow": "reject-publish-dlx"}}}
+	}`))
+	assert.Nil(tst, err, "No error")
+	assert.True(tst, result.Valid(), "Valid queue options should pass the schema")
+
+	result, err = gojsonschema.Validate(schemaLoader, gojsonschema.NewStringLoader(`{
+		"commandMeta": {"a/b": {"queue": {"maxPriority": 256}}}
+	}`))
+	assert.Nil(tst, err, "No error")
+	assert.False(tst, result.Valid(), "Priority above 255 should fail the schema")
+
+	result, err = gojsonschema.Validate(schemaLoader, gojsonschema.NewStringLoader(`{
+		"commandMeta": {"a/b": {"queue": {"overflow": "drop-tail"}}}
+	}`))
+	assert.Nil(tst, err, "No error")
+	assert.False(tst, result.Valid(), "Unknown overflow should fail the schema")
+}
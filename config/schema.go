@@ -9,6 +9,109 @@ const SCHEMA string = `
         "$schema": "http://json-schema.org/draft-04/schema#",
         "id": "/",
         "type": "object",
+        "definitions": {
+            "queueOptions": {
+                "type": "object",
+                "properties": {
+                    "messageTtlMs": {
+                        "type": "integer",
+                        "minimum": 0
+                    },
+                    "maxLength": {
+                        "type": "integer",
+                        "minimum": 0
+                    },
+                    "overflow": {
+                        "type": "string",
+                        "enum": ["", "drop-head", "reject-publish", "reject-publish-dlx"]
+                    },
+                    "deadLetterExchange": {
+                        "type": "string"
+                    },
+                    "deadLetterRoutingKey": {
+                        "type": "string"
+                    },
+                    "maxPriority": {
+                        "type": "integer",
+                        "minimum": 0,
+                        "maximum": 255
+                    },
+                    "lazy": {
+                        "type": "boolean"
+                    }
+                }
+            },
+            "corsPolicy": {
+                "type": "object",
+                "properties": {
+                    "allowedOrigins": {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        }
+                    },
+                    "allowedMethods": {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        }
+                    },
+                    "allowedHeaders": {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        }
+                    },
+                    "exposedHeaders": {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        }
+                    },
+                    "allowCredentials": {
+                        "type": "boolean"
+                    },
+                    "maxAgeSec": {
+                        "type": "integer",
+                        "minimum": 0
+                    }
+                }
+            },
+            "tlsOptions": {
+                "type": "object",
+                "properties": {
+                    "certFile": {
+                        "type": "string"
+                    },
+                    "keyFile": {
+                        "type": "string"
+                    },
+                    "minVersion": {
+                        "type": "string",
+                        "enum": ["", "1.0", "1.1", "1.2", "1.3"]
+                    },
+                    "cipherSuites": {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        }
+                    },
+                    "clientCAFile": {
+                        "type": "string"
+                    },
+                    "clientAuth": {
+                        "type": "string",
+                        "enum": ["", "none", "request", "requireAny", "verifyIfGiven", "requireAndVerify"]
+                    },
+                    "caFile": {
+                        "type": "string"
+                    },
+                    "reloadOnChange": {
+                        "type": "boolean"
+                    }
+                }
+            }
+        },
         "properties": {
 
             "apiCalls": {
@@ -42,6 +145,9 @@ const SCHEMA string = `
                                 "type": "object",
                                 "properties": {}
                             },
+                            "cors": {
+                                "$ref": "#/definitions/corsPolicy"
+                            },
                             "commands": {
                                 "type": "array",
                                 "items": {
@@ -79,7 +185,8 @@ const SCHEMA string = `
                 "type": "object",
                 "properties": {
                     "type": {
-                        "type": "string"
+                        "type": "string",
+                        "enum": ["", "memory", "redis", "redisSentinel", "redisCluster"]
                     },
                     "host": {
                         "type": "string"
@@ -90,8 +197,118 @@ const SCHEMA string = `
                     "timeoutMs": {
                         "type": "integer",
                         "minimum": 0
+                    },
+                    "keyPrefix": {
+                        "type": "string"
+                    },
+                    "memory": {
+                        "type": "object",
+                        "properties": {
+                            "maxEntries": {
+                                "type": "integer",
+                                "minimum": 0
+                            },
+                            "cleanupIntervalMs": {
+                                "type": "integer",
+                                "minimum": 0
+                            }
+                        }
+                    },
+                    "redis": {
+                        "type": "object",
+                        "properties": {
+                            "db": {
+                                "type": "integer",
+                                "minimum": 0
+                            },
+                            "poolSize": {
+                                "type": "integer",
+                                "minimum": 0
+                            },
+                            "tlsEnabled": {
+                                "type": "boolean"
+                            },
+                            "tlsCAFile": {
+                                "type": "string"
+                            },
+                            "sentinel": {
+                                "type": "object",
+                                "properties": {
+                                    "masterName": {
+                                        "type": "string"
+                                    },
+                                    "addrs": {
+                                        "type": "array",
+                                        "items": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            },
+                            "cluster": {
+                                "type": "object",
+                                "properties": {
+                                    "addrs": {
+                                        "type": "array",
+                                        "items": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            }
+                        }
                     }
-                }
+                },
+                "anyOf": [{
+                    "properties": {
+                        "type": {
+                            "enum": ["", "memory", "redis"]
+                        }
+                    }
+                }, {
+                    "required": ["type", "redis"],
+                    "properties": {
+                        "type": {
+                            "enum": ["redisSentinel"]
+                        },
+                        "redis": {
+                            "required": ["sentinel"],
+                            "properties": {
+                                "sentinel": {
+                                    "required": ["masterName", "addrs"],
+                                    "properties": {
+                                        "masterName": {
+                                            "minLength": 1
+                                        },
+                                        "addrs": {
+                                            "minItems": 1
+                                        }
+                                    }
+                                }
+                            }
+                        }
+                    }
+                }, {
+                    "required": ["type", "redis"],
+                    "properties": {
+                        "type": {
+                            "enum": ["redisCluster"]
+                        },
+                        "redis": {
+                            "required": ["cluster"],
+                            "properties": {
+                                "cluster": {
+                                    "required": ["addrs"],
+                                    "properties": {
+                                        "addrs": {
+                                            "minItems": 1
+                                        }
+                                    }
+                                }
+                            }
+                        }
+                    }
+                }]
             },
 
             "commandMeta": {
@@ -102,7 +319,11 @@ const SCHEMA string = `
                         "properties": {
                             "requiredParams": {
                                 "type": "object",
-                                "properties": {}
+                                "patternProperties": {
+                                    ".*": {
+                                        "type": "string"
+                                    }
+                                }
                             },
                             "stubData": {
                                 "type": "object",
@@ -124,6 +345,9 @@ const SCHEMA string = `
                             },
                             "shortDescription": {
                                 "type": "string"
+                            },
+                            "queue": {
+                                "$ref": "#/definitions/queueOptions"
                             }
                         }
                     }
@@ -149,12 +373,71 @@ const SCHEMA string = `
                     "tlsEnabled": {
                         "type": "boolean"
                     },
+                    "tls": {
+                        "$ref": "#/definitions/tlsOptions"
+                    },
                     "authMode": {
                         "type": "string"
                     },
                     "mqUrl": {
                         "type": "string"
                     },
+                    "mq": {
+                        "type": "object",
+                        "properties": {
+                            "urls": {
+                                "type": "array",
+                                "items": {
+                                    "type": "string",
+                                    "pattern": "^amqps?://"
+                                }
+                            },
+                            "urlPolicy": {
+                                "type": "string",
+                                "enum": ["", "ordered", "random"]
+                            },
+                            "heartbeatMs": {
+                                "type": "integer",
+                                "minimum": 0
+                            },
+                            "connectionTimeoutMs": {
+                                "type": "integer",
+                                "minimum": 0
+                            },
+                            "channelMax": {
+                                "type": "integer",
+                                "minimum": 0
+                            },
+                            "frameSize": {
+                                "type": "integer",
+                                "minimum": 0
+                            },
+                            "tls": {
+                                "$ref": "#/definitions/tlsOptions"
+                            },
+                            "reconnectBackoff": {
+                                "type": "object",
+                                "properties": {
+                                    "initialMs": {
+                                        "type": "integer",
+                                        "minimum": 0
+                                    },
+                                    "maxMs": {
+                                        "type": "integer",
+                                        "minimum": 0
+                                    },
+                                    "multiplier": {
+                                        "type": "number",
+                                        "minimum": 1
+                                    },
+                                    "maxAttempts": {
+                                        "type": "integer",
+                                        "minimum": 0
+                                    }
+                                }
+                            }
+                        }
+                    },
                     "prettyOutput": {
                         "type": "boolean"
                     },
@@ -204,7 +487,38 @@ const SCHEMA string = `
                             },
                             "queuePrefix": {
                                 "type": "string"
-                            } 
+                            },
+                            "queue": {
+                                "$ref": "#/definitions/queueOptions"
+                            }
+                        }
+                    }
+                }
+            },
+
+            "features": {
+                "type": "object",
+                "patternProperties": {
+                    ".*": {
+                        "type": "object",
+                        "properties": {
+                            "enabled": {
+                                "type": "boolean"
+                            },
+                            "percentage": {
+                                "type": "integer",
+                                "minimum": 0,
+                                "maximum": 100
+                            },
+                            "groups": {
+                                "type": "array",
+                                "items": {
+                                    "type": "string"
+                                }
+                            },
+                            "description": {
+                                "type": "string"
+                            }
                         }
                     }
                 }
@@ -213,9 +527,79 @@ const SCHEMA string = `
             "logging": {
                 "type": "object",
                 "properties": {
+                    "type": {
+                        "type": "string"
+                    },
                     "level": {
                         "type": "string"
                     },
+                    "components": {
+                        "type": "object",
+                        "patternProperties": {
+                            ".*": {
+                                "type": "string",
+                                "enum": ["debug", "info", "warn", "error", "fatal", "panic"]
+                            }
+                        }
+                    },
+                    "sinks": {
+                        "type": "array",
+                        "items": {
+                            "type": "object",
+                            "required": ["type"],
+                            "properties": {
+                                "type": {
+                                    "type": "string",
+                                    "minLength": 1
+                                },
+                                "level": {
+                                    "type": "string",
+                                    "enum": ["", "debug", "info", "warn", "error", "fatal", "panic"]
+                                },
+                                "format": {
+                                    "type": "string",
+                                    "enum": ["", "text", "json"]
+                                },
+                                "components": {
+                                    "type": "object",
+                                    "patternProperties": {
+                                        ".*": {
+                                            "type": "string",
+                                            "enum": ["debug", "info", "warn", "error", "fatal", "panic"]
+                                        }
+                                    }
+                                },
+                                "options": {
+                                    "type": "object",
+                                    "properties": {
+                                        "path": {
+                                            "type": "string"
+                                        },
+                                        "levelPaths": {
+                                            "type": "object",
+                                            "patternProperties": {
+                                                ".*": {
+                                                    "type": "string"
+                                                }
+                                            }
+                                        },
+                                        "protocol": {
+                                            "type": "string"
+                                        },
+                                        "ipPort": {
+                                            "type": "string"
+                                        },
+                                        "db": {
+                                            "type": "string"
+                                        },
+                                        "collection": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            }
+                        }
+                    },
                     "logStatsDuration":{
                         "type": "string"
                     },
@@ -273,9 +657,51 @@ const SCHEMA string = `
                                 "hmackey": {
                                     "type": "string"
                                 },
+                                "keys": {
+                                    "type": "array",
+                                    "items": {
+                                        "type": "object",
+                                        "properties": {
+                                            "id": {
+                                                "type": "string"
+                                            },
+                                            "key": {
+                                                "type": "string"
+                                            },
+                                            "notBefore": {
+                                                "type": "string",
+                                                "format": "date-time"
+                                            },
+                                            "notAfter": {
+                                                "type": "string",
+                                                "format": "date-time"
+                                            },
+                                            "status": {
+                                                "type": "string",
+                                                "enum": ["", "active", "verify-only", "revoked"]
+                                            },
+                                            "algorithm": {
+                                                "type": "string",
+                                                "enum": ["", "HS256", "HS512", "EdDSA"]
+                                            }
+                                        },
+                                        "required": ["id", "key"]
+                                    }
+                                },
+                                "algorithm": {
+                                    "type": "string",
+                                    "enum": ["", "HS256", "HS512", "EdDSA"]
+                                },
                                 "requestsPerSecond": {
                                     "type": "integer",
                                     "minimum": 0
+                                },
+                                "burst": {
+                                    "type": "integer",
+                                    "minimum": 0
+                                },
+                                "rateLimitPerIP": {
+                                    "type": "boolean"
                                 }
                             }
                         }
@@ -288,6 +714,18 @@ const SCHEMA string = `
                                 "handler": {
                                     "type": "string"
                                 },
+                                "apiCall": {
+                                    "type": "string"
+                                },
+                                "pattern": {
+                                    "type": "string"
+                                },
+                                "regex": {
+                                    "type": "string"
+                                },
+                                "priority": {
+                                    "type": "integer"
+                                },
                                 "allowGroups": {
                                     "type": "array",
                                     "items": {
@@ -303,6 +741,41 @@ const SCHEMA string = `
                             }
                         }
                     },
+                    "masterKeyFile": {
+                        "type": "string"
+                    },
+                    "jwt": {
+                        "type": "object",
+                        "properties": {
+                            "algorithm": {
+                                "type": "string",
+                                "enum": ["", "HS512", "EdDSA"]
+                            },
+                            "signingKey": {
+                                "type": "string"
+                            },
+                            "keyId": {
+                                "type": "string"
+                            },
+                            "issuer": {
+                                "type": "string"
+                            },
+                            "audience": {
+                                "type": "string"
+                            },
+                            "lifetimeSec": {
+                                "type": "integer",
+                                "minimum": 1
+                            },
+                            "clockSkewSec": {
+                                "type": "integer",
+                                "minimum": 0
+                            }
+                        }
+                    },
+                    "handlerAccessDefaultDeny": {
+                        "type": "boolean"
+                    },
                     "corsDomains": {
                         "type": "array",
                         "items": {
@@ -311,6 +784,9 @@ const SCHEMA string = `
                     },
                     "corsAutoAddLocal": {
                         "type": "boolean"
+                    },
+                    "cors": {
+                        "$ref": "#/definitions/corsPolicy"
                     }
                 }
             },
@@ -0,0 +1,176 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// EncryptedPrefix marks a config value encrypted with the master key by EncryptSecret
+const EncryptedPrefix = "enc:v1:"
+
+// MasterKeyEnv is the environment variable holding the base64 encoded master key.
+// If it's not set, the key is read from the file named by MasterKeyFileEnv, then from security > masterKeyFile.
+const MasterKeyEnv = "BOLT_MASTER_KEY"
+
+// MasterKeyFileEnv is the environment variable holding the path to a file containing the base64 encoded master key
+const MasterKeyFileEnv = "BOLT_MASTER_KEY_FILE"
+
+// MasterKeySize is the length in bytes of the AES-256 master key
+const MasterKeySize = 32
+
+// GenerateMasterKey returns a new random master key, base64 encoded for use in BOLT_MASTER_KEY or a key file
+func GenerateMasterKey() (string, error) {
+	key := make([]byte, MasterKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// LoadMasterKey reads the master key from BOLT_MASTER_KEY, the file in BOLT_MASTER_KEY_FILE, or keyFile, in that order
+func LoadMasterKey(keyFile string) ([]byte, error) {
+	encoded := os.Getenv(MasterKeyEnv)
+	if encoded == "" {
+		path := os.Getenv(MasterKeyFileEnv)
+		if path == "" {
+			path = keyFile
+		}
+		if path == "" {
+			return nil, errors.New("No master key set in " + MasterKeyEnv + ", " + MasterKeyFileEnv + " or security > masterKeyFile")
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(contents)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.New("Master key is not valid base64")
+	}
+	if len(key) != MasterKeySize {
+		return nil, errors.New("Master key must be 32 bytes")
+	}
+	return key, nil
+}
+
+// Settings that can hold encrypted values, named the way they're passed to EncryptSecret.  Group settings
+// are named by GroupHmackeySetting and GroupKeySetting.
+const (
+	SettingJWTSigningKey = "security > jwt > signingKey"
+	SettingCachePass     = "cache > pass"
+)
+
+// GroupHmackeySetting names a security group's hmackey for EncryptSecret
+func GroupHmackeySetting(group string) string {
+	return "security > groups > " + group + " > hmackey"
+}
+
+// GroupKeySetting names one of a security group's keys for EncryptSecret
+func GroupKeySetting(group string, id string) string {
+	return "security > groups > " + group + " > keys > " + id
+}
+
+// EncryptSecret encrypts plaintext with the master key using AES-256-GCM, bound to setting, ex: GroupHmackeySetting("web").
+// The result starts with EncryptedPrefix and only decrypts for the same setting, so it can't be copied into another
+// group's hmackey or the cache > pass.
+func EncryptSecret(masterKey []byte, setting string, plaintext string) (string, error) {
+	gcm, err := newGCM(masterKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(setting))
+	return EncryptedPrefix + base64.URLEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret reverses EncryptSecret for the same setting.  Values without EncryptedPrefix are returned unchanged.
+func DecryptSecret(masterKey []byte, setting string, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	sealed, err := base64.URLEncoding.DecodeString(strings.TrimPrefix(value, EncryptedPrefix))
+	if err != nil {
+		return "", errors.New("value is not valid base64")
+	}
+	gcm, err := newGCM(masterKey)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("value is too short")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(setting))
+	if err != nil {
+		return "", errors.New("wrong master key, wrong setting or corrupted value")
+	}
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether value was produced by EncryptSecret
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, EncryptedPrefix)
+}
+
+func newGCM(masterKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decryptSecrets replaces every encrypted hmackey, group key, jwt signingKey and cache > pass with its plaintext.
+// The master key is only loaded if there is something to decrypt.  Errors name the setting, never the value.
+func decryptSecrets(cfg *Config) error {
+	var masterKey []byte
+	decrypt := func(setting string, value *string) error {
+		if !IsEncrypted(*value) {
+			return nil
+		}
+		if masterKey == nil {
+			k, err := LoadMasterKey(cfg.Security.MasterKeyFile)
+			if err != nil {
+				return errors.New("Unable to decrypt " + setting + "- " + err.Error())
+			}
+			masterKey = k
+		}
+		plaintext, err := DecryptSecret(masterKey, setting, *value)
+		if err != nil {
+			return errors.New("Unable to decrypt " + setting + "- " + err.Error())
+		}
+		*value = plaintext
+		return nil
+	}
+
+	for i := range cfg.Security.Groups {
+		group := &cfg.Security.Groups[i]
+		if err := decrypt(GroupHmackeySetting(group.Name), &group.Hmackey); err != nil {
+			return err
+		}
+		for j := range group.Keys {
+			if err := decrypt(GroupKeySetting(group.Name, group.Keys[j].ID), &group.Keys[j].Key); err != nil {
+				return err
+			}
+		}
+	}
+	if err := decrypt(SettingJWTSigningKey, &cfg.Security.JWT.SigningKey); err != nil {
+		return err
+	}
+	return decrypt(SettingCachePass, &cfg.Cache.Pass)
+}
@@ -0,0 +1,107 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptDecryptSecret(tst *testing.T) {
+	encoded, err := GenerateMasterKey()
+	assert.Nil(tst, err, "No error")
+	key, _ := base64.StdEncoding.DecodeString(encoded)
+
+	encrypted, err := EncryptSecret(key, SettingCachePass, "01234567890~!@#$%^&*-_=+ABCabc")
+	assert.Nil(tst, err, "No error")
+	assert.True(tst, strings.HasPrefix(encrypted, EncryptedPrefix), "Encrypted values should be prefixed")
+	assert.False(tst, strings.Contains(encrypted, "ABCabc"), "Plaintext should not be visible")
+
+	decrypted, err := DecryptSecret(key, SettingCachePass, encrypted)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, "01234567890~!@#$%^&*-_=+ABCabc", decrypted, "Decrypted value should match the original")
+
+	plain, err := DecryptSecret(key, SettingCachePass, "not encrypted")
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, "not encrypted", plain, "Plain values are returned unchanged")
+
+	otherEncoded, _ := GenerateMasterKey()
+	otherKey, _ := base64.StdEncoding.DecodeString(otherEncoded)
+	_, err = DecryptSecret(otherKey, SettingCachePass, encrypted)
+	assert.NotNil(tst, err, "Wrong master key should fail")
+	_, err = DecryptSecret(key, SettingJWTSigningKey, encrypted)
+	assert.NotNil(tst, err, "Wrong setting should fail")
+}
+
+func TestLoadMasterKey(tst *testing.T) {
+	os.Unsetenv(MasterKeyEnv)
+	os.Unsetenv(MasterKeyFileEnv)
+
+	_, err := LoadMasterKey("")
+	assert.NotNil(tst, err, "No key source should fail")
+
+	encoded, _ := GenerateMasterKey()
+	f, err := ioutil.TempFile("", "boltmaster")
+	assert.Nil(tst, err, "No error")
+	defer os.Remove(f.Name())
+	f.WriteString(encoded + "\n")
+	f.Close()
+
+	key, err := LoadMasterKey(f.Name())
+	assert.Nil(tst, err, "Key file should load")
+	assert.Equal(tst, MasterKeySize, len(key), "Key should be 32 bytes")
+
+	os.Setenv(MasterKeyEnv, "dG9vIHNob3J0")
+	defer os.Unsetenv(MasterKeyEnv)
+	_, err = LoadMasterKey(f.Name())
+	assert.NotNil(tst, err, "The environment variable takes precedence and a short key should fail")
+}
+
+func TestDecryptSecrets(tst *testing.T) {
+	encoded, _ := GenerateMasterKey()
+	key, _ := base64.StdEncoding.DecodeString(encoded)
+	os.Setenv(MasterKeyEnv, encoded)
+	defer os.Unsetenv(MasterKeyEnv)
+
+	encryptedKey, _ := EncryptSecret(key, GroupHmackeySetting("readonly"), "readonlykey")
+	encryptedRotated, _ := EncryptSecret(key, GroupKeySetting("readonly", "2024"), "rotatedkey")
+	encryptedPass, _ := EncryptSecret(key, SettingCachePass, "redispass")
+
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	cfg.Security.Groups = []SecurityGroups{
+		{Name: "readonly", Hmackey: encryptedKey, Keys: []GroupKey{{ID: "2024", Key: encryptedRotated}}},
+		{Name: "plain", Hmackey: "plainkey"},
+	}
+	cfg.Cache.Pass = encryptedPass
+
+	assert.Nil(tst, decryptSecrets(cfg), "No error")
+	assert.Equal(tst, "readonlykey", cfg.Security.Groups[0].Hmackey, "Encrypted hmackey should be decrypted")
+	assert.Equal(tst, "rotatedkey", cfg.Security.Groups[0].Keys[0].Key, "Encrypted key should be decrypted")
+	assert.Equal(tst, "plainkey", cfg.Security.Groups[1].Hmackey, "Plain hmackey should be unchanged")
+	assert.Equal(tst, "redispass", cfg.Cache.Pass, "Encrypted cache pass should be decrypted")
+
+	// Bound to the setting it was encrypted for
+	cfg.Security.Groups = []SecurityGroups{{Name: "admin", Hmackey: encryptedKey}}
+	err = decryptSecrets(cfg)
+	assert.NotNil(tst, err, "Value moved to another group should fail")
+	assert.True(tst, strings.Contains(err.Error(), "admin"), "Error should name the group")
+	cfg.Security.Groups = nil
+	cfg.Cache.Pass = encryptedKey
+	assert.NotNil(tst, decryptSecrets(cfg), "Value moved to another setting should fail")
+	cfg.Cache.Pass = ""
+
+	tampered := encryptedKey[:len(encryptedKey)-4] + "AAAA"
+	cfg.Security.Groups = []SecurityGroups{{Name: "readonly", Hmackey: tampered}}
+	err = decryptSecrets(cfg)
+	assert.NotNil(tst, err, "Tampered value should fail")
+	assert.True(tst, strings.Contains(err.Error(), "readonly"), "Error should name the group")
+	assert.False(tst, strings.Contains(err.Error(), tampered[len(EncryptedPrefix):]), "Error should not include the ciphertext")
+}
@@ -0,0 +1,223 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSOptions holds the tls settings shared by the engine's http listener and outbound connections such as amqps
+type TLSOptions struct {
+	CertFile       string   `json:"certFile"`       // cert.pem, server cert for listeners, client cert for outbound connections
+	KeyFile        string   `json:"keyFile"`        // key.pem
+	MinVersion     string   `json:"minVersion"`     // "1.2" default (or "1.0", "1.1", "1.3")
+	CipherSuites   []string `json:"cipherSuites"`   // [] go's defaults, or names from crypto/tls ex: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"
+	ClientCAFile   string   `json:"clientCAFile"`   // "", CA bundle used by listeners to verify client certs
+	ClientAuth     string   `json:"clientAuth"`     // none (default), request, requireAny, verifyIfGiven, requireAndVerify
+	CAFile         string   `json:"caFile"`         // "", CA bundle used by outbound connections to verify servers, system roots if blank
+	ReloadOnChange bool     `json:"reloadOnChange"` // false, if true the cert and key are re-read when either file changes
+}
+
+// certCheckInterval is how often a reloading cert checks its files for changes.  Handshakes in between use the cached cert.
+var certCheckInterval = 5 * time.Second
+
+var tlsVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsClientAuthTypes = map[string]tls.ClientAuthType{
+	"":                 tls.NoClientCert,
+	"none":             tls.NoClientCert,
+	"request":          tls.RequestClientCert,
+	"requireAny":       tls.RequireAnyClientCert,
+	"verifyIfGiven":    tls.VerifyClientCertIfGiven,
+	"requireAndVerify": tls.RequireAndVerifyClientCert,
+}
+
+// BuildTLSConfig creates a *tls.Config from opts.
+// When server is true the result is meant for a listener: the cert is required and client certs are checked per ClientAuth.
+// Otherwise it's meant for an outbound connection: the cert is optional and offered as a client cert, and CAFile verifies the server.
+func BuildTLSConfig(opts TLSOptions, server bool) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[opts.MinVersion]
+	if !ok {
+		return nil, errors.New("Invalid tls config- unknown minVersion " + opts.MinVersion)
+	}
+	tlscfg := &tls.Config{MinVersion: minVersion}
+
+	if len(opts.CipherSuites) > 0 {
+		suites, err := cipherSuiteIDs(opts.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		tlscfg.CipherSuites = suites
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		reloader, err := newCertReloader(opts.CertFile, opts.KeyFile, opts.ReloadOnChange)
+		if err != nil {
+			return nil, err
+		}
+		if server {
+			tlscfg.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return reloader.certificate()
+			}
+		} else {
+			tlscfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return reloader.certificate()
+			}
+		}
+	} else if server {
+		return nil, errors.New("Invalid tls config- certFile and keyFile are required for a listener")
+	}
+
+	if server {
+		clientAuth, ok := tlsClientAuthTypes[opts.ClientAuth]
+		if !ok {
+			return nil, errors.New("Invalid tls config- unknown clientAuth " + opts.ClientAuth)
+		}
+		tlscfg.ClientAuth = clientAuth
+		if opts.ClientCAFile != "" {
+			pool, err := loadCertPool(opts.ClientCAFile)
+			if err != nil {
+				return nil, err
+			}
+			tlscfg.ClientCAs = pool
+		}
+	} else if opts.CAFile != "" {
+		pool, err := loadCertPool(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlscfg.RootCAs = pool
+	}
+
+	return tlscfg, nil
+}
+
+// EngineTLSConfig builds the *tls.Config for the engine's http listener from engine > tls.
+// engine > tlsCertFile and tlsKeyFile are used when engine > tls doesn't name its own cert and key.
+func (cfg *Config) EngineTLSConfig() (*tls.Config, error) {
+	opts := cfg.Engine.TLS
+	if opts.CertFile == "" {
+		opts.CertFile = cfg.Engine.TLSCertFile
+	}
+	if opts.KeyFile == "" {
+		opts.KeyFile = cfg.Engine.TLSKeyFile
+	}
+	return BuildTLSConfig(opts, true)
+}
+
+// cipherSuiteIDs converts crypto/tls cipher suite names into their ids
+func cipherSuiteIDs(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, errors.New("Invalid tls config- unknown cipher suite " + name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// loadCertPool reads a PEM bundle of CA certs
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("Invalid tls config- no certificates found in " + path)
+	}
+	return pool, nil
+}
+
+// certReloader holds a cert/key pair and, if reload is set, re-reads it when either file's modification time changes.
+// The files are checked at most once every certCheckInterval so handshakes don't stat them on every connection.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	reload   bool
+	now      func() time.Time
+
+	mutex     sync.Mutex
+	cert      *tls.Certificate
+	certTime  time.Time
+	keyTime   time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string, reload bool) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, reload: reload, now: time.Now}
+	r.lastCheck = r.now()
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load reads the cert and key from disk.  The caller must hold the mutex, or be the constructor.
+func (r *certReloader) load() error {
+	certTime, keyTime, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.certTime = certTime
+	r.keyTime = keyTime
+	return nil
+}
+
+func (r *certReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// certificate returns the current cert, reloading it first if reload is set, certCheckInterval has passed since the
+// last check and either file has changed.
+// If a changed pair can't be loaded (ex: the cert was replaced before the key), the previous cert keeps being served.
+func (r *certReloader) certificate() (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if now := r.now(); r.reload && now.Sub(r.lastCheck) >= certCheckInterval {
+		r.lastCheck = now
+		certTime, keyTime, err := r.modTimes()
+		if err == nil && (!certTime.Equal(r.certTime) || !keyTime.Equal(r.keyTime)) {
+			r.load()
+		}
+	}
+	return r.cert, nil
+}
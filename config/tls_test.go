@@ -0,0 +1,175 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSelfSignedCert creates a self-signed cert and key for commonName in dir, returning their paths
+func writeSelfSignedCert(tst *testing.T, dir, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(tst, err, "No error generating key")
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	assert.Nil(tst, err, "No error creating cert")
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(tst, err, "No error marshaling key")
+
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certPath, keyPath
+}
+
+func TestBuildTLSConfig(tst *testing.T) {
+	dir, err := ioutil.TempDir("", "bolttls")
+	assert.Nil(tst, err, "No error")
+	defer os.RemoveAll(dir)
+	certPath, keyPath := writeSelfSignedCert(tst, dir, "bolt")
+
+	// Outbound defaults keep the previous hard-coded TLS 1.2 minimum
+	tlscfg, err := BuildTLSConfig(TLSOptions{}, false)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, uint16(tls.VersionTLS12), tlscfg.MinVersion, "Default min version should be TLS 1.2")
+	assert.Nil(tst, tlscfg.RootCAs, "System roots are used by default")
+
+	// A listener requires a cert
+	_, err = BuildTLSConfig(TLSOptions{}, true)
+	assert.NotNil(tst, err, "Listener without a cert should fail")
+
+	tlscfg, err = BuildTLSConfig(TLSOptions{
+		CertFile:     certPath,
+		KeyFile:      keyPath,
+		MinVersion:   "1.3",
+		ClientCAFile: certPath,
+		ClientAuth:   "requireAndVerify",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+	}, true)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, uint16(tls.VersionTLS13), tlscfg.MinVersion, "Min version should be TLS 1.3")
+	assert.Equal(tst, tls.RequireAndVerifyClientCert, tlscfg.ClientAuth, "Client auth mode should be set")
+	assert.NotNil(tst, tlscfg.ClientCAs, "Client CA pool should be loaded")
+	assert.Equal(tst, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, tlscfg.CipherSuites, "Cipher suites should be converted")
+	cert, err := tlscfg.GetCertificate(nil)
+	assert.Nil(tst, err, "No error")
+	assert.NotNil(tst, cert, "Cert should be served")
+
+	// Outbound CA bundle
+	tlscfg, err = BuildTLSConfig(TLSOptions{CAFile: certPath}, false)
+	assert.Nil(tst, err, "No error")
+	assert.NotNil(tst, tlscfg.RootCAs, "CA bundle should be loaded")
+
+	_, err = BuildTLSConfig(TLSOptions{MinVersion: "0.9"}, false)
+	assert.NotNil(tst, err, "Unknown min version should fail")
+	_, err = BuildTLSConfig(TLSOptions{CipherSuites: []string{"NOT_A_SUITE"}}, false)
+	assert.NotNil(tst, err, "Unknown cipher suite should fail")
+	_, err = BuildTLSConfig(TLSOptions{CertFile: certPath, KeyFile: keyPath, ClientAuth: "sometimes"}, true)
+	assert.NotNil(tst, err, "Unknown client auth mode should fail")
+}
+
+func TestBuildTLSConfigHandshake(tst *testing.T) {
+	dir, err := ioutil.TempDir("", "bolttls")
+	assert.Nil(tst, err, "No error")
+	defer os.RemoveAll(dir)
+	certPath, keyPath := writeSelfSignedCert(tst, dir, "bolt")
+
+	servercfg, err := BuildTLSConfig(TLSOptions{CertFile: certPath, KeyFile: keyPath, ClientCAFile: certPath, ClientAuth: "requireAndVerify"}, true)
+	assert.Nil(tst, err, "No error")
+	clientcfg, err := BuildTLSConfig(TLSOptions{CertFile: certPath, KeyFile: keyPath, CAFile: certPath}, false)
+	assert.Nil(tst, err, "No error")
+	clientcfg.ServerName = "localhost"
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", servercfg)
+	assert.Nil(tst, err, "No error")
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), clientcfg)
+	assert.Nil(tst, err, "Mutual TLS handshake should succeed")
+	if err == nil {
+		conn.Close()
+	}
+}
+
+func TestCertReload(tst *testing.T) {
+	dir, err := ioutil.TempDir("", "bolttls")
+	assert.Nil(tst, err, "No error")
+	defer os.RemoveAll(dir)
+	certPath, keyPath := writeSelfSignedCert(tst, dir, "first")
+
+	reloader, err := newCertReloader(certPath, keyPath, true)
+	assert.Nil(tst, err, "No error")
+	now := time.Now()
+	reloader.now = func() time.Time { return now }
+	commonName := func() string {
+		cert, err := reloader.certificate()
+		assert.Nil(tst, err, "No error")
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		return leaf.Subject.CommonName
+	}
+	assert.Equal(tst, "first", commonName(), "First cert should be served")
+
+	// Replace the pair and move the modification times so the change is seen regardless of filesystem granularity
+	writeSelfSignedCert(tst, dir, "second")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certPath, later, later)
+	os.Chtimes(keyPath, later, later)
+
+	now = now.Add(certCheckInterval / 2)
+	assert.Equal(tst, "first", commonName(), "Cached cert should be served until the check interval passes")
+
+	now = now.Add(certCheckInterval)
+	assert.Equal(tst, "second", commonName(), "Replaced cert should be served after the check interval")
+}
+
+func TestEngineTLSConfig(tst *testing.T) {
+	dir, err := ioutil.TempDir("", "bolttls")
+	assert.Nil(tst, err, "No error")
+	defer os.RemoveAll(dir)
+	certPath, keyPath := writeSelfSignedCert(tst, dir, "bolt")
+
+	cfg, err := DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	cfg.Engine.TLSCertFile = certPath
+	cfg.Engine.TLSKeyFile = keyPath
+
+	tlscfg, err := cfg.EngineTLSConfig()
+	assert.Nil(tst, err, "engine > tlsCertFile and tlsKeyFile should be used")
+	assert.Equal(tst, tls.NoClientCert, tlscfg.ClientAuth, "Client certs aren't requested by default")
+}
@@ -0,0 +1,99 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+var (
+	workerSchemasLock sync.RWMutex
+	workerSchemas     = make(map[string]*gojsonschema.Schema)
+)
+
+// RegisterWorkerSchema registers a json schema for the workerConfig > name section.
+// Once registered, BuildConfig (and Builder) validate that section against it, so a worker can call this
+// before loading the config and have mistakes in its settings reported at load time.
+// Registering the same name again replaces the schema.
+func RegisterWorkerSchema(name string, schema string) error {
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema))
+	if err != nil {
+		return errors.New("Invalid schema for workerConfig > " + name + "- " + err.Error())
+	}
+
+	workerSchemasLock.Lock()
+	defer workerSchemasLock.Unlock()
+	workerSchemas[name] = compiled
+	return nil
+}
+
+// WorkerSection decodes the workerConfig > name section into target, which should be a pointer to a struct or map
+func WorkerSection(cfg *Config, name string, target interface{}) error {
+	sections, err := workerSections(cfg)
+	if err != nil {
+		return err
+	}
+	section, ok := sections[name]
+	if !ok {
+		return errors.New("workerConfig > " + name + " not found")
+	}
+	if err := json.Unmarshal(section, target); err != nil {
+		return errors.New("Unable to decode workerConfig > " + name + "- " + err.Error())
+	}
+	return nil
+}
+
+// workerSections splits workerConfig into its top level sections
+func workerSections(cfg *Config) (map[string]json.RawMessage, error) {
+	sections := make(map[string]json.RawMessage)
+	if len(cfg.WorkerConfig) == 0 {
+		return sections, nil
+	}
+	if err := json.Unmarshal(cfg.WorkerConfig, &sections); err != nil {
+		return nil, errors.New("Invalid workerConfig- " + err.Error())
+	}
+	return sections, nil
+}
+
+// validateWorkerConfig checks each registered workerConfig section against its schema.
+// A missing section is validated as null, so it fails unless the schema allows null.
+func (cfg *Config) validateWorkerConfig() error {
+	workerSchemasLock.RLock()
+	defer workerSchemasLock.RUnlock()
+	if len(workerSchemas) == 0 {
+		return nil
+	}
+
+	sections, err := workerSections(cfg)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(workerSchemas))
+	for name := range workerSchemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		section, ok := sections[name]
+		if !ok {
+			section = json.RawMessage("null")
+		}
+		result, err := workerSchemas[name].Validate(gojsonschema.NewStringLoader(string(section)))
+		if err != nil {
+			return err
+		}
+		if !result.Valid() {
+			return schemaError("Invalid workerConfig > "+name, result)
+		}
+	}
+	return nil
+}
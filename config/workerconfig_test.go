@@ -0,0 +1,61 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+const testPrimaryDbSchema = `{
+	"type": "object",
+	"required": ["host", "port"],
+	"properties": {
+		"host": {"type": "string"},
+		"port": {"type": "integer", "minimum": 1}
+	}
+}`
+
+func TestRegisterWorkerSchema(tst *testing.T) {
+	defer func() {
+		workerSchemas = make(map[string]*gojsonschema.Schema)
+	}()
+
+	assert.NotNil(tst, RegisterWorkerSchema("broken", `{"type": 5`), "Invalid schema should fail to register")
+	assert.Nil(tst, RegisterWorkerSchema("primaryDb", testPrimaryDbSchema), "No error")
+
+	_, err := NewBuilder().WithWorkerConfig(`{"primaryDb": {"host": "localhost", "port": 5432}}`).Build()
+	assert.Nil(tst, err, "Valid section should pass")
+
+	_, err = NewBuilder().WithWorkerConfig(`{"primaryDb": {"hots": "localhost", "port": 5432}}`).Build()
+	assert.NotNil(tst, err, "Typo in a required key should fail")
+	assert.True(tst, strings.Contains(err.Error(), "workerConfig > primaryDb"), "Error should name the section")
+
+	_, err = NewBuilder().WithWorkerConfig(`{"other": {}}`).Build()
+	assert.NotNil(tst, err, "Missing registered section should fail")
+}
+
+func TestWorkerSection(tst *testing.T) {
+	cfg, err := NewBuilder().WithWorkerConfig(`{"primaryDb": {"host": "localhost", "port": 5432}}`).Build()
+	assert.Nil(tst, err, "No error")
+
+	var db struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
+	assert.Nil(tst, WorkerSection(cfg, "primaryDb", &db), "No error")
+	assert.Equal(tst, "localhost", db.Host, "Host should decode")
+	assert.Equal(tst, 5432, db.Port, "Port should decode")
+
+	assert.NotNil(tst, WorkerSection(cfg, "missing", &db), "Missing section should fail")
+
+	var wrong struct {
+		Host int `json:"host"`
+	}
+	assert.NotNil(tst, WorkerSection(cfg, "primaryDb", &wrong), "Mismatched types should fail")
+}
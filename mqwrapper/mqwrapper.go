@@ -9,9 +9,14 @@ package mqwrapper
 
 import (
 	"crypto/tls"
+	"errors"
+	"math/rand"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/TeamFairmont/amqp"
+	config "github.com/TeamFairmont/boltshared/config"
 	"github.com/TeamFairmont/gabs"
 )
 
@@ -37,7 +42,12 @@ func ConnectMQ(amqpURL string) (*Connection, error) {
 	var err error
 
 	if strings.HasPrefix(amqpURL, "amqps") {
-		conn, err = amqp.DialTLS(amqpURL, &tls.Config{MinVersion: tls.VersionTLS12})
+		var tlscfg *tls.Config
+		tlscfg, err = config.BuildTLSConfig(config.TLSOptions{}, false)
+		if err != nil {
+			return nil, err
+		}
+		conn, err = amqp.DialTLS(amqpURL, tlscfg)
 	} else {
 		conn, err = amqp.Dial(amqpURL)
 	}
@@ -54,6 +64,103 @@ func ConnectMQ(amqpURL string) (*Connection, error) {
 	return &Connection{conn, ch}, nil
 }
 
+// ConnectMQConfig connects to the first reachable broker in mqcfg.URLs, trying them in order or shuffled
+// according to mqcfg.URLPolicy, with the heartbeat, timeout, channel max and frame size settings applied.
+// If every url fails, the whole list is retried after a growing backoff until ReconnectBackoff.MaxAttempts passes
+// have been made (0 retries forever).  Use cfg.MQSettings() to get an mqcfg that honors engine > mqUrl.
+// amqps urls use mqcfg.TLS for their tls settings.
+// Returns the Connection and an open Channel
+func ConnectMQConfig(mqcfg config.MQConfig) (*Connection, error) {
+	if len(mqcfg.URLs) == 0 {
+		return nil, errors.New("No mq urls configured")
+	}
+
+	amqpcfg := amqp.Config{
+		Heartbeat:  time.Duration(mqcfg.HeartbeatMs) * time.Millisecond,
+		ChannelMax: mqcfg.ChannelMax,
+		FrameSize:  mqcfg.FrameSize,
+	}
+	if mqcfg.ConnectionTimeoutMs > 0 {
+		timeout := time.Duration(mqcfg.ConnectionTimeoutMs) * time.Millisecond
+		amqpcfg.Dial = func(network, addr string) (net.Conn, error) {
+			return net.DialTimeout(network, addr, timeout)
+		}
+	}
+
+	var tlscfg *tls.Config
+	for _, url := range mqcfg.URLs {
+		if strings.HasPrefix(url, "amqps") {
+			var err error
+			tlscfg, err = config.BuildTLSConfig(mqcfg.TLS, false)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	var err error
+	for attempt := 0; mqcfg.ReconnectBackoff.MaxAttempts == 0 || attempt < mqcfg.ReconnectBackoff.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoffDelay(mqcfg, attempt))
+		}
+		for _, url := range brokerOrder(mqcfg) {
+			urlcfg := amqpcfg
+			if strings.HasPrefix(url, "amqps") {
+				urlcfg.TLSClientConfig = tlscfg.Clone()
+			}
+
+			var conn *amqp.Connection
+			conn, err = amqp.DialConfig(url, urlcfg)
+			if err != nil {
+				continue
+			}
+
+			var ch *amqp.Channel
+			ch, err = conn.Channel()
+			if err != nil {
+				// The broker accepted the connection but not a channel, try the next one
+				conn.Close()
+				continue
+			}
+			return &Connection{conn, ch}, nil
+		}
+	}
+	return nil, err
+}
+
+// brokerOrder returns the urls to try for a single pass, shuffled if the url policy is random
+func brokerOrder(mqcfg config.MQConfig) []string {
+	urls := make([]string, len(mqcfg.URLs))
+	if mqcfg.URLPolicy == config.MQURLPolicyRandom {
+		for i, j := range rand.Perm(len(mqcfg.URLs)) {
+			urls[i] = mqcfg.URLs[j]
+		}
+		return urls
+	}
+	copy(urls, mqcfg.URLs)
+	return urls
+}
+
+// backoffDelay returns how long to wait before the given pass (1 being the first retry) through the url list
+func backoffDelay(mqcfg config.MQConfig, attempt int) time.Duration {
+	delay := float64(mqcfg.ReconnectBackoff.InitialMs)
+	multiplier := mqcfg.ReconnectBackoff.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	for i := 1; i < attempt; i++ {
+		delay *= multiplier
+		if mqcfg.ReconnectBackoff.MaxMs > 0 && delay >= float64(mqcfg.ReconnectBackoff.MaxMs) {
+			break
+		}
+	}
+	if mqcfg.ReconnectBackoff.MaxMs > 0 && delay > float64(mqcfg.ReconnectBackoff.MaxMs) {
+		delay = float64(mqcfg.ReconnectBackoff.MaxMs)
+	}
+	return time.Duration(delay) * time.Millisecond
+}
+
 // CreateConsumeTempQueue uses an open channel to create a temp queue for a command
 // Returns the queue, the consume channel, and an error if either fails to create
 func CreateConsumeTempQueue(ch *amqp.Channel) (*amqp.Queue, <-chan amqp.Delivery, error) {
@@ -95,14 +202,21 @@ func CloseRes() {
 // CreateConsumeNamedQueue uses an open channel to create a durable named queue
 // Returns the queue, the consume channel, and an error if either fails to create
 func CreateConsumeNamedQueue(name string, ch *amqp.Channel) (*amqp.Queue, <-chan amqp.Delivery, error) {
+	return CreateConsumeNamedQueueWithOptions(name, ch, config.QueueOptions{})
+}
+
+// CreateConsumeNamedQueueWithOptions uses an open channel to create a durable named queue with the
+// ttl, max length, dead-letter etc. settings in opts, usually from cfg.QueueOptionsFor(command)
+// Returns the queue, the consume channel, and an error if either fails to create
+func CreateConsumeNamedQueueWithOptions(name string, ch *amqp.Channel, opts config.QueueOptions) (*amqp.Queue, <-chan amqp.Delivery, error) {
 	//setup queue to receive responses
 	q, err := ch.QueueDeclare(
-		name,  // name
-		true,  // durable
-		false, // delete when usused
-		false, // exclusive
-		false, // noWait
-		nil,   // arguments
+		name,            // name
+		true,            // durable
+		false,           // delete when usused
+		false,           // exclusive
+		false,           // noWait
+		QueueArgs(opts), // arguments
 	)
 	if err != nil {
 		return nil, nil, err
@@ -131,6 +245,39 @@ func CreateConsumeNamedQueue(name string, ch *amqp.Channel) (*amqp.Queue, <-chan
 
 }
 
+// QueueArgs converts queue options into the x-arguments for QueueDeclare.
+// Returns nil if no options are set, so the queue is declared exactly as before options existed.
+func QueueArgs(opts config.QueueOptions) amqp.Table {
+	args := amqp.Table{}
+	if opts.MessageTTLMs > 0 {
+		args["x-message-ttl"] = opts.MessageTTLMs
+	}
+	if opts.MaxLength > 0 {
+		args["x-max-length"] = opts.MaxLength
+	}
+	if opts.Overflow != "" {
+		args["x-overflow"] = opts.Overflow
+	}
+	if opts.DeadLetterExchange != "" || opts.DeadLetterRoutingKey != "" {
+		// A blank exchange is the default exchange, which routes straight to the queue named by the routing key
+		args["x-dead-letter-exchange"] = opts.DeadLetterExchange
+		if opts.DeadLetterRoutingKey != "" {
+			args["x-dead-letter-routing-key"] = opts.DeadLetterRoutingKey
+		}
+	}
+	if opts.MaxPriority > 0 {
+		args["x-max-priority"] = opts.MaxPriority
+	}
+	if opts.Lazy {
+		args["x-queue-mode"] = "lazy"
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
 // PublishCommand pushes a processing command up to the MQ with its uuid, command name, and payload
 // The replyTo should normally be set to the queue.Name created via CreateConsumeTempQueue
 func PublishCommand(q *amqp.Channel, id string, prefix string, command string, payload *gabs.Container, replyTo string) error {
@@ -0,0 +1,129 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/TeamFairmont/boltshared/utils"
+)
+
+// compiled holds the regular expressions built from handlerAccess patterns and regexes, keyed by source
+var compiled sync.Map
+
+// Authorize checks whether group may access url according to security > handlerAccess.
+// Rules are checked by descending priority, then config order.  The first rule that matches url and names the group
+// (or "*") in denyGroups or allowGroups decides; a matching rule with allowGroups that doesn't name the group denies.
+// Matching rules that only deny other groups are skipped.  If no rule decides, access is allowed unless
+// security > handlerAccessDefaultDeny is set.  rule is the deciding rule, or nil when the default applied.
+func Authorize(cfg *config.Config, group string, url string) (allowed bool, rule *config.HandlerAccess) {
+	for _, r := range cfg.HandlerAccessRules() {
+		if !ruleMatches(r, url) {
+			continue
+		}
+		if groupListed(group, r.DenyGroups) {
+			return false, r
+		}
+		if groupListed(group, r.AllowGroups) {
+			return true, r
+		}
+		if len(r.AllowGroups) > 0 {
+			return false, r
+		}
+	}
+	return !cfg.Security.HandlerAccessDefaultDeny, nil
+}
+
+// ruleMatches reports whether any of the rule's non-blank matchers match url
+func ruleMatches(r *config.HandlerAccess, url string) bool {
+	if r.HandlerURL != "" && r.HandlerURL == url {
+		return true
+	}
+	if r.APICall != "" && apiCallMatches(r.APICall, url) {
+		return true
+	}
+	if r.Pattern != "" {
+		if re := compile("glob:"+r.Pattern, globToRegex(r.Pattern)); re != nil && re.MatchString(url) {
+			return true
+		}
+	}
+	if r.Regex != "" {
+		if re := compile("regex:"+r.Regex, r.Regex); re != nil && re.MatchString(url) {
+			return true
+		}
+	}
+	return false
+}
+
+// APICallPrefixes are the engine paths followed by an api call name, ex: /request/v1/addProduct.
+// handlerAccess apiCall rules match the url directly or after one of these.
+var APICallPrefixes = []string{"/request/", "/work/"}
+
+// apiCallMatches checks apiCall as a prefix of url, or of url after one of APICallPrefixes.
+// The match must end at a path segment, so v1/add matches /request/v1/add and /request/v1/add/x but not /request/v1/addProduct.
+func apiCallMatches(apiCall string, url string) bool {
+	if apiCallPrefixOf(apiCall, url) {
+		return true
+	}
+	for _, prefix := range APICallPrefixes {
+		if strings.HasPrefix(url, prefix) && apiCallPrefixOf(apiCall, url[len(prefix):]) {
+			return true
+		}
+	}
+	return false
+}
+
+// apiCallPrefixOf checks apiCall as a prefix of path that ends at a "/" or the end of path
+func apiCallPrefixOf(apiCall string, path string) bool {
+	if !strings.HasPrefix(path, apiCall) {
+		return false
+	}
+	return len(path) == len(apiCall) || strings.HasSuffix(apiCall, "/") || path[len(apiCall)] == '/'
+}
+
+func groupListed(group string, groups []string) bool {
+	return utils.StringInSlice(group, groups) || utils.StringInSlice("*", groups)
+}
+
+// compile returns the cached regexp for key, compiling expr the first time.  Invalid expressions return nil
+// and never match; BuildConfig rejects invalid handlerAccess regexes.
+func compile(key string, expr string) *regexp.Regexp {
+	if re, ok := compiled.Load(key); ok {
+		return re.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil
+	}
+	compiled.Store(key, re)
+	return re
+}
+
+// globToRegex converts a url glob into an anchored regular expression.
+// ** matches anything, * matches anything except "/", and ? matches a single character except "/".
+func globToRegex(glob string) string {
+	var buf strings.Builder
+	buf.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				buf.WriteString(".*")
+				i++
+			} else {
+				buf.WriteString("[^/]*")
+			}
+		case '?':
+			buf.WriteString("[^/]")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	buf.WriteString("$")
+	return buf.String()
+}
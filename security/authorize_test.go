@@ -0,0 +1,104 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"testing"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorize(tst *testing.T) {
+	cfg, err := config.DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	cfg, err = config.CustomizeConfig(cfg, config.TestConfigJSON)
+	assert.Nil(tst, err, "No error")
+
+	// Exact handler rules from the test config
+	allowed, rule := Authorize(cfg, "engineadmin", "/get-config")
+	assert.True(tst, allowed, "engineadmin may get the config")
+	assert.Equal(tst, "/get-config", rule.HandlerURL, "The /get-config rule decided")
+
+	allowed, rule = Authorize(cfg, "normal", "/get-config")
+	assert.False(tst, allowed, "normal may not get the config")
+	assert.Equal(tst, "/get-config", rule.HandlerURL, "The /get-config rule decided")
+
+	allowed, rule = Authorize(cfg, "throttled", "/v1/test")
+	assert.False(tst, allowed, "throttled is denied /v1/test")
+
+	allowed, rule = Authorize(cfg, "normal", "/v1/test")
+	assert.True(tst, allowed, "A deny rule for another group doesn't decide")
+	assert.Nil(tst, rule, "The default decided")
+
+	// Patterns, regexes, api call prefixes and priority
+	cfg.Security.HandlerAccess = []config.HandlerAccess{
+		{Pattern: "/work/v1/product/*", AllowGroups: []string{"catalog"}},
+		{Pattern: "/work/**/admin", DenyGroups: []string{"*"}},
+		{Regex: "^/work/v[0-9]+/orders", AllowGroups: []string{"orders"}},
+		{APICall: "v2/", AllowGroups: []string{"beta"}},
+		{HandlerURL: "/work/v1/product/special", AllowGroups: []string{"special"}, Priority: 10},
+	}
+
+	allowed, rule = Authorize(cfg, "catalog", "/work/v1/product/add")
+	assert.True(tst, allowed, "Glob should allow catalog")
+	assert.Equal(tst, "/work/v1/product/*", rule.Pattern, "The glob rule decided")
+
+	allowed, _ = Authorize(cfg, "catalog", "/work/v1/product/add/extra")
+	assert.True(tst, allowed, "* should not cross path segments, so no rule decides")
+
+	allowed, rule = Authorize(cfg, "catalog", "/work/v1/deep/path/admin")
+	assert.False(tst, allowed, "** should cross path segments and * should deny everyone")
+	assert.Equal(tst, "/work/**/admin", rule.Pattern, "The admin rule decided")
+
+	allowed, rule = Authorize(cfg, "catalog", "/work/v3/orders/list")
+	assert.False(tst, allowed, "Regex rule should deny groups not allowed")
+	assert.Equal(tst, "^/work/v[0-9]+/orders", rule.Regex, "The regex rule decided")
+
+	allowed, _ = Authorize(cfg, "beta", "/work/v2/anything")
+	assert.True(tst, allowed, "Api call prefix should match after a path segment")
+
+	cfg.Security.HandlerAccess = append(cfg.Security.HandlerAccess, config.HandlerAccess{APICall: "v1/add", DenyGroups: []string{"catalog"}})
+
+	allowed, rule = Authorize(cfg, "catalog", "/request/v1/add")
+	assert.False(tst, allowed, "Api call should match after /request/")
+	assert.Equal(tst, "v1/add", rule.APICall, "The api call rule decided")
+
+	allowed, rule = Authorize(cfg, "catalog", "/request/x/v1/addProductAdmin")
+	assert.True(tst, allowed, "Api call should only match after an engine path")
+	assert.Nil(tst, rule, "The default decided")
+
+	allowed, rule = Authorize(cfg, "catalog", "/request/v1/addProduct")
+	assert.Nil(tst, rule, "Api call match should end at a path segment")
+
+	allowed, rule = Authorize(cfg, "special", "/work/v1/product/special")
+	assert.True(tst, allowed, "Higher priority rule should be checked before the glob")
+	assert.Equal(tst, 10, rule.Priority, "The priority rule decided")
+
+	allowed, rule = Authorize(cfg, "catalog", "/work/v1/product/special")
+	assert.False(tst, allowed, "Higher priority allow list should deny other groups")
+
+	// Default deny
+	cfg.Security.HandlerAccessDefaultDeny = true
+	allowed, rule = Authorize(cfg, "normal", "/unlisted")
+	assert.False(tst, allowed, "Default deny should deny unmatched urls")
+	assert.Nil(tst, rule, "The default decided")
+}
+
+func TestAPICallMatches(tst *testing.T) {
+	assert.True(tst, apiCallMatches("v1/add", "/request/v1/add"), "Whole call after /request/")
+	assert.True(tst, apiCallMatches("v1/add", "/work/v1/add/extra"), "Call followed by a segment after /work/")
+	assert.True(tst, apiCallMatches("v2/", "/request/v2/anything"), "Call ending in / matches any call under it")
+	assert.True(tst, apiCallMatches("/pending", "/pending"), "Call matching the url from the start")
+	assert.False(tst, apiCallMatches("v1/add", "/request/v1/addProduct"), "Match must end at a path segment")
+	assert.False(tst, apiCallMatches("v1/add", "/request/x/v1/add"), "Match must start right after the engine path")
+	assert.False(tst, apiCallMatches("v1/add", "/other/v1/add"), "Unknown paths don't match")
+}
+
+func TestGlobToRegex(tst *testing.T) {
+	assert.Equal(tst, `^/a/[^/]*/b\.json$`, globToRegex("/a/*/b.json"), "Single star and dots should convert")
+	assert.Equal(tst, `^/a/.*$`, globToRegex("/a/**"), "Double star should convert")
+	assert.Equal(tst, `^/v[^/]$`, globToRegex("/v?"), "Question mark should convert")
+}
@@ -0,0 +1,97 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Clock supplies the current time when checking timestamps, so tests can control it
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock used unless another is given, returning time.Now
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock is a Clock that only moves when told to, for tests around the verifyTimeout boundary or clock skew.
+// It is safe for concurrent use.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock stopped at now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now implements Clock
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set moves the clock to now
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	c.now = now
+	c.mu.Unlock()
+}
+
+// Advance moves the clock forward by d, or back if d is negative
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// millisecondThreshold separates unix seconds from unix milliseconds: as seconds it's the year 33658,
+// as milliseconds it's September 2001
+const millisecondThreshold = 1e12
+
+// parseTimestamp reads a timestamp as unix seconds, unix milliseconds or RFC 3339, and returns the precision it was given in
+func parseTimestamp(timestamp string) (t time.Time, precision time.Duration, err error) {
+	if n, err := strconv.ParseInt(timestamp, 10, 64); err == nil {
+		if n >= millisecondThreshold || n <= -millisecondThreshold {
+			return time.UnixMilli(n), time.Millisecond, nil
+		}
+		return time.Unix(n, 0), time.Second, nil
+	}
+	t, err = time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return time.Time{}, 0, malformed("timestamp", err)
+	}
+	return t, time.Nanosecond, nil
+}
+
+// checkTimestamp returns an *ExpiredError unless timestamp is within +-verifyTimeout seconds of clock's time.
+// The current time is truncated to the timestamp's precision, so a unix seconds timestamp exactly verifyTimeout old is accepted.
+func checkTimestamp(clock Clock, timestamp string, verifyTimeout int64) error {
+	t, precision, err := parseTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Duration(verifyTimeout) * time.Second
+	if verifyTimeout > int64(math.MaxInt64/time.Second) {
+		timeout = math.MaxInt64
+	}
+	skew := clock.Now().Truncate(precision).Sub(t)
+	if skew > timeout || skew < -timeout {
+		return &ExpiredError{Skew: skew, Timeout: timeout}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimestamp(tst *testing.T) {
+	want := time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC)
+
+	t, precision, err := parseTimestamp(strconv.FormatInt(want.Unix(), 10))
+	assert.Nil(tst, err, "Unix seconds should parse")
+	assert.True(tst, want.Equal(t), "Unix seconds should match")
+	assert.Equal(tst, time.Second, precision, "Unix seconds have second precision")
+
+	t, precision, err = parseTimestamp(strconv.FormatInt(want.UnixMilli()+250, 10))
+	assert.Nil(tst, err, "Unix milliseconds should parse")
+	assert.True(tst, want.Add(250*time.Millisecond).Equal(t), "Unix milliseconds should match")
+	assert.Equal(tst, time.Millisecond, precision, "Unix milliseconds have millisecond precision")
+
+	t, _, err = parseTimestamp("2016-05-04T05:02:01.5+02:00")
+	assert.Nil(tst, err, "RFC 3339 should parse")
+	assert.True(tst, want.Add(500*time.Millisecond).Equal(t), "RFC 3339 should match, including the zone")
+
+	_, _, err = parseTimestamp("May 4 2016")
+	assert.True(tst, errors.Is(err, ErrMalformedEnvelope), "Other formats are malformed")
+}
+
+func TestCheckTimestampBoundary(tst *testing.T) {
+	start := time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC)
+	clock := NewFakeClock(start)
+	seconds := strconv.FormatInt(start.Unix(), 10)
+	millis := strconv.FormatInt(start.UnixMilli(), 10)
+	rfc := start.Format(time.RFC3339)
+
+	for _, ts := range []string{seconds, millis, rfc} {
+		clock.Set(start.Add(30 * time.Second))
+		assert.Nil(tst, checkTimestamp(clock, ts, 30), "Exactly verifyTimeout old is accepted: "+ts)
+		clock.Set(start.Add(-30 * time.Second))
+		assert.Nil(tst, checkTimestamp(clock, ts, 30), "Exactly verifyTimeout ahead is accepted: "+ts)
+	}
+
+	// Seconds timestamps are compared in whole seconds, the others to the millisecond or better
+	clock.Set(start.Add(30*time.Second + 999*time.Millisecond))
+	assert.Nil(tst, checkTimestamp(clock, seconds, 30), "Seconds timestamp is still within the same second")
+	err := checkTimestamp(clock, millis, 30)
+	var expired *ExpiredError
+	assert.True(tst, errors.As(err, &expired), "Milliseconds timestamp is past the timeout")
+	assert.Equal(tst, 30*time.Second+999*time.Millisecond, expired.Skew, "Skew should be exact")
+
+	clock.Advance(time.Millisecond)
+	assert.True(tst, errors.Is(checkTimestamp(clock, seconds, 30), ErrExpired), "Seconds timestamp is now 31 seconds old")
+
+	// Clients with fast clocks
+	clock.Set(start.Add(-31 * time.Second))
+	err = checkTimestamp(clock, rfc, 30)
+	assert.True(tst, errors.As(err, &expired), "Timestamp too far in the future is rejected")
+	assert.Equal(tst, -31*time.Second, expired.Skew, "Skew is negative for a future timestamp")
+}
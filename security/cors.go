@@ -0,0 +1,158 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/TeamFairmont/boltshared/utils"
+)
+
+// CorsEvaluator decides which CORS headers to send for a request's Origin and path.
+// Create one with NewCorsEvaluator when the config is loaded, and again whenever it's reloaded.
+type CorsEvaluator struct {
+	global   config.CorsPolicy
+	apiCalls map[string]*config.CorsPolicy
+	origins  []string // security > corsDomains plus the local addresses, checked for every policy
+}
+
+// NewCorsEvaluator builds an evaluator from security > cors, security > corsDomains and the per api call overrides.
+// If security > corsAutoAddLocal is set, localhost and every local IP (from utils.GetLocalIPs) are allowed on any scheme and port.
+func NewCorsEvaluator(cfg *config.Config) (*CorsEvaluator, error) {
+	e := &CorsEvaluator{
+		global:   cfg.Security.Cors,
+		apiCalls: make(map[string]*config.CorsPolicy),
+	}
+	e.origins = append(e.origins, cfg.Security.CorsDomains...)
+
+	if cfg.Security.CorsAutoAddLocal {
+		ips, err := utils.GetLocalIPs()
+		if err != nil {
+			return nil, err
+		}
+		e.origins = append(e.origins, "localhost")
+		e.origins = append(e.origins, ips...)
+	}
+
+	for name, call := range cfg.APICalls {
+		if call.Cors != nil {
+			e.apiCalls[name] = call.Cors
+		}
+	}
+	return e, nil
+}
+
+// Headers returns the CORS headers to send for a request from origin to path.
+// The policy of the api call matching path is used if it has one, otherwise security > cors.
+// If origin is blank or not allowed, only the Vary header is returned.
+func (e *CorsEvaluator) Headers(origin string, path string) http.Header {
+	headers := http.Header{}
+	headers.Set("Vary", "Origin")
+	if origin == "" {
+		return headers
+	}
+
+	policy := e.policyFor(path)
+	allowed, anyOrigin := e.originAllowed(origin, policy)
+	if !allowed {
+		return headers
+	}
+
+	headers.Set("Access-Control-Allow-Origin", origin)
+	// Config validation rejects "*" with credentials; a policy built in code still never gets them from any origin
+	if policy.AllowCredentials && !anyOrigin {
+		headers.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(policy.AllowedMethods) > 0 {
+		headers.Set("Access-Control-Allow-Methods", strings.Join(policy.AllowedMethods, ", "))
+	}
+	if len(policy.AllowedHeaders) > 0 {
+		headers.Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+	}
+	if len(policy.ExposedHeaders) > 0 {
+		headers.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+	}
+	if policy.MaxAgeSec > 0 {
+		headers.Set("Access-Control-Max-Age", strconv.FormatInt(policy.MaxAgeSec, 10))
+	}
+	return headers
+}
+
+// policyFor returns the policy of the longest api call name that path ends with, ex: /request/v1/test uses v1/test
+func (e *CorsEvaluator) policyFor(path string) *config.CorsPolicy {
+	var policy *config.CorsPolicy
+	matched := ""
+	trimmed := strings.TrimSuffix(path, "/")
+	for name, p := range e.apiCalls {
+		if len(name) > len(matched) && (trimmed == name || strings.HasSuffix(trimmed, "/"+name)) {
+			policy = p
+			matched = name
+		}
+	}
+	if policy == nil {
+		return &e.global
+	}
+	return policy
+}
+
+// originAllowed reports whether origin is allowed by policy or the evaluator's origins, and whether only a "*" allowed it
+func (e *CorsEvaluator) originAllowed(origin string, policy *config.CorsPolicy) (allowed bool, anyOrigin bool) {
+	for _, patterns := range [][]string{policy.AllowedOrigins, e.origins} {
+		for _, pattern := range patterns {
+			if !matchOrigin(pattern, origin) {
+				continue
+			}
+			if pattern != "*" {
+				return true, false
+			}
+			allowed, anyOrigin = true, true
+		}
+	}
+	return allowed, anyOrigin
+}
+
+// matchOrigin reports whether origin (scheme://host[:port]) matches pattern.
+// pattern may leave out the scheme and/or port to match any, and may start its host with "*." to match any subdomain.
+func matchOrigin(pattern string, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	o, err := url.Parse(origin)
+	if err != nil || o.Host == "" {
+		return false
+	}
+
+	scheme := ""
+	host := pattern
+	if i := strings.Index(pattern, "://"); i >= 0 {
+		scheme = pattern[:i]
+		host = pattern[i+3:]
+	}
+	host = strings.TrimSuffix(host, "/")
+
+	if scheme != "" && !strings.EqualFold(scheme, o.Scheme) {
+		return false
+	}
+
+	hostname, port := host, ""
+	if i := strings.LastIndex(host, ":"); i >= 0 && !strings.Contains(host[i:], "]") {
+		hostname, port = host[:i], host[i+1:]
+	}
+	if port != "" && port != o.Port() {
+		return false
+	}
+
+	originHost := strings.ToLower(o.Hostname())
+	hostname = strings.ToLower(strings.Trim(hostname, "[]"))
+	if strings.HasPrefix(hostname, "*.") {
+		return strings.HasSuffix(originHost, hostname[1:])
+	}
+	return originHost == hostname
+}
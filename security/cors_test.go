@@ -0,0 +1,94 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"testing"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchOrigin(tst *testing.T) {
+	assert.True(tst, matchOrigin("https://*.example.com", "https://app.example.com"), "Wildcard should match a subdomain")
+	assert.True(tst, matchOrigin("https://*.example.com", "https://a.b.example.com"), "Wildcard should match nested subdomains")
+	assert.False(tst, matchOrigin("https://*.example.com", "https://example.com"), "Wildcard should not match the bare domain")
+	assert.False(tst, matchOrigin("https://*.example.com", "https://evilexample.com"), "Wildcard should not match a lookalike domain")
+	assert.False(tst, matchOrigin("https://*.example.com", "http://app.example.com"), "Scheme should match when given")
+	assert.True(tst, matchOrigin("https://app.example.com", "https://app.example.com:8443"), "No port in the pattern matches any port")
+	assert.False(tst, matchOrigin("https://app.example.com:443", "https://app.example.com:8443"), "Port should match when given")
+	assert.True(tst, matchOrigin("localhost", "http://localhost:3000"), "Host only pattern matches any scheme and port")
+	assert.True(tst, matchOrigin("*", "https://anything.test"), "* matches any origin")
+	assert.False(tst, matchOrigin("localhost", "null"), "Opaque origins never match")
+}
+
+func TestCorsEvaluator(tst *testing.T) {
+	cfg, err := config.DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	cfg, err = config.CustomizeConfig(cfg, `{
+		"security": {
+			"corsDomains": ["https://legacy.example.org"],
+			"corsAutoAddLocal": true,
+			"cors": {
+				"allowedOrigins": ["https://*.example.com"],
+				"allowedMethods": ["GET", "POST"],
+				"exposedHeaders": ["X-Request-Id"],
+				"allowCredentials": true,
+				"maxAgeSec": 600
+			}
+		},
+		"apiCalls": {
+			"v1/public": {
+				"cors": {
+					"allowedOrigins": ["*"],
+					"allowedMethods": ["GET"]
+				}
+			}
+		}
+	}`)
+	assert.Nil(tst, err, "No error")
+
+	e, err := NewCorsEvaluator(cfg)
+	assert.Nil(tst, err, "No error")
+
+	h := e.Headers("https://app.example.com", "/request/v1/test")
+	assert.Equal(tst, "https://app.example.com", h.Get("Access-Control-Allow-Origin"), "Allowed origin should be echoed")
+	assert.Equal(tst, "true", h.Get("Access-Control-Allow-Credentials"), "Credentials should be allowed")
+	assert.Equal(tst, "GET, POST", h.Get("Access-Control-Allow-Methods"), "Methods should be listed")
+	assert.Equal(tst, "X-Request-Id", h.Get("Access-Control-Expose-Headers"), "Exposed headers should be listed")
+	assert.Equal(tst, "600", h.Get("Access-Control-Max-Age"), "Max age should be set")
+	assert.Equal(tst, "Origin", h.Get("Vary"), "Vary should always be set")
+
+	h = e.Headers("https://legacy.example.org", "/request/v1/test")
+	assert.Equal(tst, "https://legacy.example.org", h.Get("Access-Control-Allow-Origin"), "corsDomains should still be allowed")
+
+	h = e.Headers("http://127.0.0.1:3000", "/request/v1/test")
+	assert.Equal(tst, "http://127.0.0.1:3000", h.Get("Access-Control-Allow-Origin"), "Local addresses should be allowed")
+
+	h = e.Headers("https://evil.test", "/request/v1/test")
+	assert.Equal(tst, "", h.Get("Access-Control-Allow-Origin"), "Unknown origin should not be allowed")
+	assert.Equal(tst, "Origin", h.Get("Vary"), "Vary should always be set")
+
+	h = e.Headers("https://evil.test", "/request/v1/public")
+	assert.Equal(tst, "https://evil.test", h.Get("Access-Control-Allow-Origin"), "Api call override should allow any origin")
+	assert.Equal(tst, "GET", h.Get("Access-Control-Allow-Methods"), "Api call override should replace the methods")
+	assert.Equal(tst, "", h.Get("Access-Control-Allow-Credentials"), "Api call override should replace credentials")
+
+	// A wildcard policy built in code never allows credentials
+	cfg.APICalls["v1/public"].Cors.AllowCredentials = true
+	e, err = NewCorsEvaluator(cfg)
+	assert.Nil(tst, err, "No error")
+	h = e.Headers("https://evil.test", "/request/v1/public")
+	assert.Equal(tst, "", h.Get("Access-Control-Allow-Credentials"), "Credentials should not be allowed from any origin")
+	h = e.Headers("https://app.example.com", "/request/v1/public")
+	assert.Equal(tst, "", h.Get("Access-Control-Allow-Credentials"), "Credentials should not be allowed when only * matches")
+	cfg.APICalls["v1/public"].Cors.AllowCredentials = false
+
+	cfg.Security.CorsAutoAddLocal = false
+	e, err = NewCorsEvaluator(cfg)
+	assert.Nil(tst, err, "No error")
+	h = e.Headers("http://127.0.0.1:3000", "/request/v1/test")
+	assert.Equal(tst, "", h.Get("Access-Control-Allow-Origin"), "Local addresses should not be allowed without corsAutoAddLocal")
+}
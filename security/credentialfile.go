@@ -0,0 +1,264 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+)
+
+// FileCredentialStore is a CredentialStore kept in a json file holding an array of Credentials, ex:
+// [{"group": "web", "id": "2024-06", "key": "$argon2id$...", "notAfter": "2025-01-01T00:00:00Z"}]
+// Credentials can be added or revoked while the engine runs, with Put and Revoke, which rewrite the file,
+// or by editing the file and calling Reload (or Watch).  Lookups never wait for an update.
+// Every credential is checked as the config's would be: hashed keys only with simple auth, EdDSA keys must be
+// public keys, and the algorithm and status must be known.
+// Last use is kept in memory and written to the file whenever it's saved.
+type FileCredentialStore struct {
+	path     string
+	authMode int          // config.AuthModeHMAC or AuthModeSimple
+	mu       sync.Mutex   // held by writers
+	groups   atomic.Value // map[string][]Credential, replaced rather than changed
+	modTime  time.Time    // of the file when last read or written, held under mu
+	lastUsed lastUsedTimes
+}
+
+// NewFileCredentialStore loads the credentials in path for the engine's authMode, ex: cfg.Engine.AuthModeValue.
+// If the file doesn't exist the store starts empty, and the file is created by the first Put.
+func NewFileCredentialStore(path string, authMode int) (*FileCredentialStore, error) {
+	s := &FileCredentialStore{path: path, authMode: authMode}
+	s.groups.Store(map[string][]Credential{})
+	if err := s.Reload(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Credentials implements CredentialStore
+func (s *FileCredentialStore) Credentials(group string) ([]Credential, error) {
+	creds, ok := s.groups.Load().(map[string][]Credential)[group]
+	if !ok {
+		return nil, ErrUnknownGroup
+	}
+	out := make([]Credential, len(creds))
+	for i, c := range creds {
+		if t := s.lastUsed.get(group, c.ID); t != nil {
+			c.LastUsed = t
+		}
+		out[i] = c
+	}
+	return out, nil
+}
+
+// MarkUsed implements CredentialStore
+func (s *FileCredentialStore) MarkUsed(group string, id string, t time.Time) error {
+	s.lastUsed.mark(group, id, t)
+	return nil
+}
+
+// Reload reads the file again, replacing the credentials.  If the file can't be read or parsed the credentials are unchanged.
+func (s *FileCredentialStore) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Put adds the credential, or replaces the group's credential with the same ID, and saves the file
+func (s *FileCredentialStore) Put(cred Credential) error {
+	if err := s.validate(cred); err != nil {
+		return errors.New("Security error- " + err.Error())
+	}
+	return s.update(func(groups map[string][]Credential) error {
+		creds := append([]Credential(nil), groups[cred.Group]...)
+		for i, c := range creds {
+			if c.ID == cred.ID {
+				creds = append(creds[:i], creds[i+1:]...)
+				break
+			}
+		}
+		groups[cred.Group] = append(creds, cred)
+		return nil
+	})
+}
+
+// Revoke marks the group's credential id as revoked and saves the file.  It takes effect for every lookup that follows.
+func (s *FileCredentialStore) Revoke(group string, id string) error {
+	return s.update(func(groups map[string][]Credential) error {
+		creds, ok := groups[group]
+		if !ok {
+			return ErrUnknownGroup
+		}
+		for i, c := range creds {
+			if c.ID == id {
+				creds = append([]Credential(nil), creds...)
+				creds[i].Status = config.KeyStatusRevoked
+				groups[group] = creds
+				return nil
+			}
+		}
+		return errors.New("Security error- No credential " + id + " for group " + group)
+	})
+}
+
+// Watch reloads the file whenever its modification time changes, checking every interval until done is closed.
+// Errors, ex: from a half-written file, are passed to onError if it isn't nil, and the previous credentials are kept.
+func (s *FileCredentialStore) Watch(interval time.Duration, done <-chan bool, onError func(error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(s.path)
+			if err != nil {
+				if onError != nil && !os.IsNotExist(err) {
+					onError(err)
+				}
+				continue
+			}
+			s.mu.Lock()
+			if !info.ModTime().Equal(s.modTime) {
+				err = s.load()
+			}
+			s.mu.Unlock()
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+}
+
+// update applies change to a copy of the credentials, saves it, then makes it visible to lookups
+func (s *FileCredentialStore) update(change func(groups map[string][]Credential) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := s.groups.Load().(map[string][]Credential)
+	groups := make(map[string][]Credential, len(current)+1)
+	for group, creds := range current {
+		groups[group] = creds
+	}
+	if err := change(groups); err != nil {
+		return err
+	}
+	if err := s.save(groups); err != nil {
+		return err
+	}
+	s.groups.Store(groups)
+	return nil
+}
+
+// load reads the file, under mu
+func (s *FileCredentialStore) load() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var creds []Credential
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return errors.New("Security error- Invalid credential file " + s.path + ": " + err.Error())
+	}
+
+	groups := make(map[string][]Credential)
+	for _, c := range creds {
+		if err := s.validate(c); err != nil {
+			return errors.New("Security error- Invalid credential file " + s.path + ": " + err.Error())
+		}
+		if c.LastUsed != nil {
+			s.lastUsed.mark(c.Group, c.ID, *c.LastUsed)
+			c.LastUsed = nil
+		}
+		groups[c.Group] = append(groups[c.Group], c)
+	}
+	s.groups.Store(groups)
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// validate checks a credential the way the config's keys are checked, so a hash or public key is never used as an hmac secret
+func (s *FileCredentialStore) validate(c Credential) error {
+	if c.Group == "" {
+		return errors.New("credential has no group")
+	}
+	name := "credential " + c.ID + " for group " + c.Group
+	if c.Key == "" {
+		return errors.New(name + " has no key")
+	}
+	switch c.Status {
+	case "", config.KeyStatusActive, config.KeyStatusVerifyOnly, config.KeyStatusRevoked:
+	default:
+		return errors.New(name + " has unknown status " + c.Status)
+	}
+	switch {
+	case isHMACAlgorithm(c.Algorithm):
+		if config.IsHashedKey(c.Key) && s.authMode != config.AuthModeSimple {
+			return errors.New(name + " has a hashed key, which only works with engine > authMode simple")
+		}
+	case c.Algorithm == config.AlgEdDSA:
+		if _, err := NewVerifier(config.AlgEdDSA, c.Key); err != nil {
+			return errors.New(name + " must be a base64 Ed25519 public key")
+		}
+	default:
+		return errors.New(name + " has unknown algorithm " + c.Algorithm)
+	}
+	return nil
+}
+
+// save writes groups to the file, under mu.  It writes a temporary file and renames it, so readers of the file
+// never see it half written.
+func (s *FileCredentialStore) save(groups map[string][]Credential) error {
+	names := make([]string, 0, len(groups))
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+	creds := []Credential{}
+	for _, group := range names {
+		for _, c := range groups[group] {
+			c.LastUsed = s.lastUsed.get(group, c.ID)
+			creds = append(creds, c)
+		}
+	}
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return nil
+}
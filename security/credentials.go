@@ -0,0 +1,208 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+)
+
+// Credential is one of a group's keys as held by a CredentialStore.  It expires at NotAfter, and is revoked
+// by setting its Status to config.KeyStatusRevoked.  The group's hmackey is the credential with a blank ID.
+type Credential struct {
+	Group string `json:"group"`
+	config.GroupKey
+	LastUsed *time.Time `json:"lastUsed,omitempty"` // when the credential last authenticated a request, nil if never
+}
+
+// Revoked reports whether the credential has been revoked
+func (c Credential) Revoked() bool {
+	return c.Status == config.KeyStatusRevoked
+}
+
+// Expired reports whether the credential's notAfter has passed at now
+func (c Credential) Expired(now time.Time) bool {
+	return c.NotAfter != nil && !now.Before(*c.NotAfter)
+}
+
+// CredentialStore holds the credentials of every security group.  ConfigCredentialStore reads them from
+// security > groups; FileCredentialStore keeps them in a file that can change while the engine runs.
+// Implementations must be safe for concurrent use.
+type CredentialStore interface {
+	// Credentials returns every credential of group, including revoked and expired ones, or ErrUnknownGroup
+	Credentials(group string) ([]Credential, error)
+	// MarkUsed records that group's credential id authenticated a request at t
+	MarkUsed(group string, id string, t time.Time) error
+}
+
+// GetKeyFromStore returns the hmac key to sign for group with, the same key as config.SecurityGroups.SigningKey:
+// the usable key with the latest notBefore, or the hmackey if the group has no other keys.
+// Only HS256 and HS512 keys are considered; EdDSA keys are public and hashed keys aren't the key itself.
+// It returns ErrNoCredential if no key can sign, ex: every key is revoked or expired, or the group only has EdDSA keys.
+func GetKeyFromStore(store CredentialStore, group string) (key string, err error) {
+	all, err := store.Credentials(group)
+	if err != nil {
+		return "Error", err
+	}
+	var creds []Credential
+	for _, c := range all {
+		if isHMACKey(c.GroupKey) {
+			creds = append(creds, c)
+		}
+	}
+	hasKeys := false
+	for _, c := range creds {
+		if c.ID != "" {
+			hasKeys = true
+			break
+		}
+	}
+
+	now := time.Now()
+	var best *Credential
+	for i, c := range creds {
+		if (c.ID != "") != hasKeys || !c.CanSign(now) {
+			continue
+		}
+		if best == nil || startOf(c.GroupKey).After(startOf(best.GroupKey)) {
+			best = &creds[i]
+		}
+	}
+	if best == nil {
+		return "Error", ErrNoCredential
+	}
+	return best.Key, nil
+}
+
+// startOf returns k's notBefore, or the zero time if it has none
+func startOf(k config.GroupKey) time.Time {
+	if k.NotBefore == nil {
+		return time.Time{}
+	}
+	return *k.NotBefore
+}
+
+// AuthenticateWithStore is AuthenticateGroup for a CredentialStore.  Revoked and expired credentials never authenticate,
+// and the credential that does is marked as used.
+func AuthenticateWithStore(store CredentialStore, group string, key string) (authenticated bool) {
+	creds, err := store.Credentials(group)
+	if err != nil {
+		return false
+	}
+	now := time.Now()
+	for _, c := range creds {
+		// EdDSA keys are public, so they can't authenticate anyone
+		if !c.CanVerify(now) || !isHMACAlgorithm(c.Algorithm) {
+			continue
+		}
+		if VerifyKey(c.Key, key) {
+			store.MarkUsed(group, c.ID, now)
+			return true
+		}
+	}
+	return false
+}
+
+// StoreKeys returns a KeyLookup over store, for a MessageVerifier.  Only credentials that can verify at the time are returned,
+// and credentials without an algorithm are HS512.  Hashed keys, which are only for simple auth, and keys with an unknown
+// algorithm are never returned; EdDSA keys are, and only ever verify EdDSA signatures.
+func StoreKeys(store CredentialStore) KeyLookup {
+	return func(group string, now time.Time) ([]config.GroupKey, error) {
+		creds, err := store.Credentials(group)
+		if err != nil {
+			return nil, err
+		}
+		var keys []config.GroupKey
+		for _, c := range creds {
+			if !c.CanVerify(now) || config.IsHashedKey(c.Key) {
+				continue
+			}
+			if c.Algorithm == "" {
+				c.Algorithm = config.AlgHS512
+			}
+			if !isHMACAlgorithm(c.Algorithm) && c.Algorithm != config.AlgEdDSA {
+				continue
+			}
+			keys = append(keys, c.GroupKey)
+		}
+		return keys, nil
+	}
+}
+
+// configLastUsed records the last use of every ConfigCredentialStore's credentials, so it outlives the store,
+// ex: one made for a single GetKeyFromGroup call, or the stores of a config before it was reloaded
+var configLastUsed lastUsedTimes
+
+// ConfigCredentialStore is a CredentialStore over security > groups.  Each group's hmackey and keys are its credentials.
+// Last use is kept in memory, shared by every ConfigCredentialStore in the process.
+type ConfigCredentialStore struct {
+	groups *[]config.SecurityGroups
+}
+
+// NewConfigCredentialStore returns a store over groups, ex: &cfg.Security.Groups
+func NewConfigCredentialStore(groups *[]config.SecurityGroups) *ConfigCredentialStore {
+	return &ConfigCredentialStore{groups: groups}
+}
+
+// Credentials implements CredentialStore
+func (s *ConfigCredentialStore) Credentials(group string) ([]Credential, error) {
+	var creds []Credential
+	found := false
+	for _, g := range *s.groups {
+		if g.Name != group {
+			continue
+		}
+		found = true
+		for _, k := range g.AllKeys() {
+			creds = append(creds, Credential{Group: group, GroupKey: k, LastUsed: configLastUsed.get(group, k.ID)})
+		}
+	}
+	if !found {
+		return nil, ErrUnknownGroup
+	}
+	return creds, nil
+}
+
+// MarkUsed implements CredentialStore
+func (s *ConfigCredentialStore) MarkUsed(group string, id string, t time.Time) error {
+	configLastUsed.mark(group, id, t)
+	return nil
+}
+
+// lastUsedTimes records when each credential was last used, without locking readers
+type lastUsedTimes struct {
+	times sync.Map // group + "\x00" + id: *int64 unix nanoseconds
+}
+
+// mark sets the credential's last use to t, unless it's already later
+func (l *lastUsedTimes) mark(group string, id string, t time.Time) {
+	nanos := t.UnixNano()
+	v, _ := l.times.LoadOrStore(group+"\x00"+id, new(int64))
+	p := v.(*int64)
+	for {
+		old := atomic.LoadInt64(p)
+		if old >= nanos || atomic.CompareAndSwapInt64(p, old, nanos) {
+			return
+		}
+	}
+}
+
+// get returns the credential's last use, or nil if it hasn't been used
+func (l *lastUsedTimes) get(group string, id string) *time.Time {
+	v, ok := l.times.Load(group + "\x00" + id)
+	if !ok {
+		return nil
+	}
+	nanos := atomic.LoadInt64(v.(*int64))
+	if nanos == 0 {
+		// Stored by mark but not yet set
+		return nil
+	}
+	t := time.Unix(0, nanos).UTC()
+	return &t
+}
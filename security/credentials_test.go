@@ -0,0 +1,248 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigCredentialStore(tst *testing.T) {
+	later := time.Now().Add(-time.Hour)
+	groups := []config.SecurityGroups{
+		{Name: "legacy", Hmackey: "legacykey"},
+		{Name: "rotating", Keys: []config.GroupKey{
+			{ID: "old", Key: "oldkey"},
+			{ID: "new", Key: "newkey", NotBefore: &later},
+			{ID: "leaked", Key: "leakedkey", Status: config.KeyStatusRevoked},
+		}},
+		{Name: "revoked", Keys: []config.GroupKey{{ID: "a", Key: "akey", Status: config.KeyStatusRevoked}}},
+	}
+	store := NewConfigCredentialStore(&groups)
+
+	key, err := GetKeyFromStore(store, "legacy")
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, "legacykey", key, "hmackey is the key")
+	key, err = GetKeyFromStore(store, "rotating")
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, "newkey", key, "Newest active key is the key")
+	_, err = GetKeyFromStore(store, "revoked")
+	assert.True(tst, errors.Is(err, ErrNoCredential), "Group with every key revoked has no key")
+	_, err = GetKeyFromStore(store, "nogroup")
+	assert.True(tst, errors.Is(err, ErrUnknownGroup), "Unknown group")
+
+	// The same key SigningKey picks
+	for _, g := range groups {
+		want, ok := g.SigningKey(time.Now())
+		key, err = GetKeyFromStore(store, g.Name)
+		assert.Equal(tst, ok, err == nil, "Both find a key for "+g.Name)
+		if ok {
+			assert.Equal(tst, want.Key, key, "Both pick the same key for "+g.Name)
+		}
+	}
+	both := []config.SecurityGroups{{Name: "both", Hmackey: "oldhmackey", Keys: []config.GroupKey{{ID: "k1", Key: "newkey"}}}}
+	key, err = GetKeyFromGroup("both", &both)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, "newkey", key, "Keys take precedence over the hmackey, as in SigningKey")
+	keysOnly := []config.SecurityGroups{{Name: "keysonly", Keys: []config.GroupKey{{ID: "k1", Key: "verifykey", Status: config.KeyStatusVerifyOnly}}}}
+	key, err = GetKeyFromGroup("keysonly", &keysOnly)
+	assert.True(tst, errors.Is(err, ErrNoCredential), "A group with no key that can sign has no key")
+	assert.NotEqual(tst, "", key, "The blank hmackey is never returned")
+
+	creds, err := store.Credentials("rotating")
+	assert.Nil(tst, err, "No error")
+	assert.Len(tst, creds, 3, "Revoked credentials are listed")
+	assert.True(tst, creds[2].Revoked(), "Revoked credential")
+
+	assert.True(tst, AuthenticateWithStore(store, "rotating", "oldkey"), "Old key still authenticates")
+	assert.False(tst, AuthenticateWithStore(store, "rotating", "leakedkey"), "Revoked key doesn't authenticate")
+	creds, _ = store.Credentials("rotating")
+	assert.NotNil(tst, creds[0].LastUsed, "Used credential records its last use")
+	assert.Nil(tst, creds[1].LastUsed, "Unused credential has no last use")
+
+	// GetKeyFromGroup and AuthenticateGroup use the config store
+	key, err = GetKeyFromGroup("rotating", &groups)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, "newkey", key, "GetKeyFromGroup returns the newest active key")
+	assert.False(tst, AuthenticateGroup("rotating", "leakedkey", &groups), "Revoked key doesn't authenticate")
+
+	// Last use outlives the store AuthenticateGroup makes
+	assert.True(tst, AuthenticateGroup("legacy", "legacykey", &groups), "hmackey authenticates")
+	creds, _ = NewConfigCredentialStore(&groups).Credentials("legacy")
+	assert.NotNil(tst, creds[0].LastUsed, "Last use should be kept")
+}
+
+func TestFileCredentialStoreValidation(tst *testing.T) {
+	dir, _ := ioutil.TempDir("", "credentials")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials.json")
+	hashed, _ := HashKey("simplekey")
+	pub, _, _ := GenerateEd25519Key()
+
+	store, _ := NewFileCredentialStore(path, config.AuthModeHMAC)
+	assert.NotNil(tst, store.Put(Credential{Group: "web", GroupKey: config.GroupKey{ID: "h", Key: hashed}}), "Hashed key needs simple auth")
+	assert.NotNil(tst, store.Put(Credential{Group: "web", GroupKey: config.GroupKey{ID: "x", Key: "webkey", Algorithm: "RS256"}}), "Unknown algorithm")
+	assert.NotNil(tst, store.Put(Credential{Group: "web", GroupKey: config.GroupKey{ID: "x", Key: "webkey", Status: "paused"}}), "Unknown status")
+	assert.NotNil(tst, store.Put(Credential{Group: "web", GroupKey: config.GroupKey{ID: "e", Key: "webkey", Algorithm: config.AlgEdDSA}}), "EdDSA key must be a public key")
+	assert.NotNil(tst, store.Put(Credential{Group: "web", GroupKey: config.GroupKey{ID: "b"}}), "Blank key")
+	assert.Nil(tst, store.Put(Credential{Group: "web", GroupKey: config.GroupKey{ID: "e", Key: pub, Algorithm: config.AlgEdDSA}}), "EdDSA public key")
+	assert.Nil(tst, store.Put(Credential{Group: "web", GroupKey: config.GroupKey{ID: "s", Key: "webkey", Algorithm: config.AlgHS256}}), "HS256 key")
+
+	// StoreKeys verifies with each key's own algorithm, and the public key is never an hmac key
+	keys, err := StoreKeys(store)("web", time.Now())
+	assert.Nil(tst, err, "No error")
+	assert.Len(tst, keys, 2, "Both keys verify")
+	key, err := GetKeyFromStore(store, "web")
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, "webkey", key, "Only the HS256 key signs")
+
+	data, _ := json.Marshal([]Credential{{Group: "web", GroupKey: config.GroupKey{ID: "h", Key: hashed}}})
+	ioutil.WriteFile(path, data, 0600)
+	_, err = NewFileCredentialStore(path, config.AuthModeHMAC)
+	assert.NotNil(tst, err, "File with a hashed key needs simple auth")
+
+	// With simple auth hashed keys authenticate, but are never used to sign or verify messages
+	simple, err := NewFileCredentialStore(path, config.AuthModeSimple)
+	assert.Nil(tst, err, "No error")
+	assert.True(tst, AuthenticateWithStore(simple, "web", "simplekey"), "Hashed key authenticates")
+	keys, _ = StoreKeys(simple)("web", time.Now())
+	assert.Len(tst, keys, 0, "Hashed key doesn't verify messages")
+	_, err = GetKeyFromStore(simple, "web")
+	assert.True(tst, errors.Is(err, ErrNoCredential), "Hashed key doesn't sign")
+}
+
+func TestFileCredentialStore(tst *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	assert.Nil(tst, err, "No error")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials.json")
+
+	store, err := NewFileCredentialStore(path, config.AuthModeHMAC)
+	assert.Nil(tst, err, "Missing file starts empty")
+	_, err = store.Credentials("web")
+	assert.True(tst, errors.Is(err, ErrUnknownGroup), "No groups yet")
+
+	// Added at runtime
+	expired := time.Now().Add(-time.Minute)
+	assert.Nil(tst, store.Put(Credential{Group: "web", GroupKey: config.GroupKey{ID: "k1", Key: "webkey"}}), "No error")
+	assert.Nil(tst, store.Put(Credential{Group: "web", GroupKey: config.GroupKey{ID: "k0", Key: "oldkey", NotAfter: &expired}}), "No error")
+	assert.True(tst, AuthenticateWithStore(store, "web", "webkey"), "New credential authenticates")
+	assert.False(tst, AuthenticateWithStore(store, "web", "oldkey"), "Expired credential doesn't authenticate")
+	creds, _ := store.Credentials("web")
+	assert.True(tst, creds[1].Expired(time.Now()), "Credential should be expired")
+
+	// Revoked at runtime, and saved with the last use
+	assert.Nil(tst, store.Revoke("web", "k1"), "No error")
+	assert.False(tst, AuthenticateWithStore(store, "web", "webkey"), "Revoked credential doesn't authenticate")
+	assert.NotNil(tst, store.Revoke("web", "nokey"), "Unknown credential can't be revoked")
+
+	reopened, err := NewFileCredentialStore(path, config.AuthModeHMAC)
+	assert.Nil(tst, err, "No error")
+	creds, err = reopened.Credentials("web")
+	assert.Nil(tst, err, "No error")
+	assert.Len(tst, creds, 2, "Both credentials should be saved")
+	assert.True(tst, creds[0].Revoked(), "Revocation should be saved")
+	assert.NotNil(tst, creds[0].LastUsed, "Last use should be saved")
+
+	// Replaced by id
+	assert.Nil(tst, store.Put(Credential{Group: "web", GroupKey: config.GroupKey{ID: "k1", Key: "rotated"}}), "No error")
+	creds, _ = store.Credentials("web")
+	assert.Len(tst, creds, 2, "Put should replace the credential with the same id")
+	assert.True(tst, AuthenticateWithStore(store, "web", "rotated"), "Replaced credential authenticates")
+
+	// Edited on disk
+	data, _ := json.Marshal([]Credential{{Group: "api", GroupKey: config.GroupKey{ID: "a", Key: "apikey"}}})
+	assert.Nil(tst, ioutil.WriteFile(path, data, 0600), "No error")
+	assert.Nil(tst, store.Reload(), "No error")
+	assert.True(tst, AuthenticateWithStore(store, "api", "apikey"), "Reloaded credential authenticates")
+	_, err = store.Credentials("web")
+	assert.True(tst, errors.Is(err, ErrUnknownGroup), "Removed group is gone")
+
+	assert.Nil(tst, ioutil.WriteFile(path, []byte("{half written"), 0600), "No error")
+	assert.NotNil(tst, store.Reload(), "Invalid file should fail")
+	assert.True(tst, AuthenticateWithStore(store, "api", "apikey"), "Credentials are kept when the file is invalid")
+}
+
+func TestFileCredentialStoreWatch(tst *testing.T) {
+	dir, _ := ioutil.TempDir("", "credentials")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials.json")
+	store, _ := NewFileCredentialStore(path, config.AuthModeHMAC)
+
+	done := make(chan bool)
+	defer close(done)
+	store.Watch(5*time.Millisecond, done, nil)
+
+	data, _ := json.Marshal([]Credential{{Group: "api", GroupKey: config.GroupKey{ID: "a", Key: "apikey"}}})
+	ioutil.WriteFile(path, data, 0600)
+	deadline := time.Now().Add(2 * time.Second)
+	for !AuthenticateWithStore(store, "api", "apikey") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.True(tst, AuthenticateWithStore(store, "api", "apikey"), "Watch should pick up the new file")
+}
+
+func TestFileCredentialStoreConcurrent(tst *testing.T) {
+	dir, _ := ioutil.TempDir("", "credentials")
+	defer os.RemoveAll(dir)
+	store, _ := NewFileCredentialStore(filepath.Join(dir, "credentials.json"), config.AuthModeHMAC)
+	store.Put(Credential{Group: "web", GroupKey: config.GroupKey{ID: "base", Key: "webkey"}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				assert.True(tst, AuthenticateWithStore(store, "web", "webkey"), "Lookups should succeed during updates")
+				_, err := GetKeyFromStore(store, "web")
+				assert.Nil(tst, err, "No error")
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		store.Put(Credential{Group: "web", GroupKey: config.GroupKey{ID: strconv.Itoa(i), Key: "key" + strconv.Itoa(i)}})
+		store.Revoke("web", strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	creds, _ := store.Credentials("web")
+	assert.Len(tst, creds, 21, "Every credential should be kept")
+}
+
+func TestMiddlewareCredentialStore(tst *testing.T) {
+	dir, _ := ioutil.TempDir("", "credentials")
+	defer os.RemoveAll(dir)
+	store, _ := NewFileCredentialStore(filepath.Join(dir, "credentials.json"), config.AuthModeHMAC)
+	store.Put(Credential{Group: "web", GroupKey: config.GroupKey{ID: "k1", Key: "webkey"}})
+
+	cfg := middlewareTestConfig(tst, "hmac")
+	handler := Middleware(cfg, MiddlewareOptions{Credentials: store})(echoHandler)
+
+	encoded, _ := EncodeWithSigner(newHMACSigner(config.AlgHS512, "webkey"), "k1", "hi", strconv.FormatInt(time.Now().Unix(), 10), "")
+	rec, _ := serve(handler, "web", "", "/request/v1/test", string(encoded))
+	assert.Equal(tst, 200, rec.Code, "Key from the store should verify")
+
+	verifier := NewMessageVerifierWithStore(cfg, store)
+	_, kid, err := verifier.Decode("web", encoded)
+	assert.Nil(tst, err, "Verifier over the store decodes")
+	assert.Equal(tst, "k1", kid, "Key id should be returned")
+
+	store.Revoke("web", "k1")
+	rec, _ = serve(handler, "web", "", "/request/v1/test", string(encoded))
+	assert.Equal(tst, 401, rec.Code, "Revoked key should be rejected without a restart")
+	_, _, err = verifier.Decode("web", encoded)
+	assert.True(tst, errors.Is(err, ErrBadSignature), "Verifier over the store sees the revocation")
+}
@@ -0,0 +1,141 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// EncryptionVersion is the envelope version written by EncryptMessage.  DecryptMessage rejects versions it doesn't know,
+// so the scheme can change later without old and new envelopes being confused.
+const EncryptionVersion = 1
+
+// encryptionInfo binds keys derived for message encryption to this purpose and version
+const encryptionInfo = "bolt message encryption v1"
+
+const encryptionSaltSize = 16
+
+// encryptedEnvelope is the json sent by EncryptMessage.  Salt, nonce and ciphertext are base64url encoded.
+type encryptedEnvelope struct {
+	Version    int    `json:"v"`
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// EncryptMessage encrypts and authenticates a message with AES-256-GCM, for payloads that must not be readable
+// in transit, such as customer PII.  Unlike EncodeHMAC, which only signs, the message can't be read without the key.
+// A fresh key is derived from the group's hmac key with HKDF-SHA256 and a random salt for every message.
+// timestamp is checked by DecryptMessage just as DecodeHMAC checks it.
+func EncryptMessage(key string, rawmessage string, timestamp string) (encrypted []byte, err error) {
+	plaintext, err := json.Marshal(map[string]string{
+		"timestamp": timestamp,
+		"message":   rawmessage,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, encryptionSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	gcm, err := messageCipher(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	env := encryptedEnvelope{
+		Version: EncryptionVersion,
+		Salt:    base64.URLEncoding.EncodeToString(salt),
+		Nonce:   base64.URLEncoding.EncodeToString(nonce),
+	}
+	env.Ciphertext = base64.URLEncoding.EncodeToString(gcm.Seal(nil, nonce, plaintext, envelopeAAD(env.Version)))
+	return json.Marshal(env)
+}
+
+// DecryptMessage reverses EncryptMessage.  It fails with ErrMalformedEnvelope if the envelope or its version is unknown,
+// ErrBadSignature if the key is wrong or the envelope was altered, or ErrExpired if the timestamp is outside of +-verifyTimeout seconds.
+func DecryptMessage(key string, encrypted []byte, verifyTimeout int64) (decryptedMessage string, err error) {
+	var env encryptedEnvelope
+	if err := json.Unmarshal(encrypted, &env); err != nil {
+		return "", malformed("envelope", err)
+	}
+	if env.Version != EncryptionVersion {
+		return "", malformed("unsupported encryption version "+strconv.Itoa(env.Version), nil)
+	}
+
+	salt, err := base64.URLEncoding.DecodeString(env.Salt)
+	if err != nil {
+		return "", malformed("salt", err)
+	}
+	nonce, err := base64.URLEncoding.DecodeString(env.Nonce)
+	if err != nil {
+		return "", malformed("nonce", err)
+	}
+	ciphertext, err := base64.URLEncoding.DecodeString(env.Ciphertext)
+	if err != nil {
+		return "", malformed("ciphertext", err)
+	}
+
+	gcm, err := messageCipher(key, salt)
+	if err != nil {
+		return "", err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return "", malformed("nonce", nil)
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, envelopeAAD(env.Version))
+	if err != nil {
+		// GCM authenticates the ciphertext, so a wrong key or altered envelope is a bad signature
+		return "", ErrBadSignature
+	}
+
+	payload, err := verifyTime(plaintext, verifyTimeout, SystemClock)
+	if err != nil {
+		return "", err
+	}
+	return payload["message"], nil
+}
+
+// messageCipher derives the AES-256 key for one message from the group key and salt
+func messageCipher(key string, salt []byte) (cipher.AEAD, error) {
+	aesKey, err := hkdfSHA256([]byte(key), salt, []byte(encryptionInfo), 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// envelopeAAD authenticates the envelope version along with the ciphertext
+func envelopeAAD(version int) []byte {
+	return []byte("bolt-enc-v" + strconv.Itoa(version))
+}
+
+// hkdfSHA256 derives length bytes from secret (RFC 5869 extract then expand), length at most 255*32
+func hkdfSHA256(secret []byte, salt []byte, info []byte, length int) ([]byte, error) {
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,65 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHKDFSHA256(tst *testing.T) {
+	// RFC 5869 test case 1
+	ikm, _ := hex.DecodeString("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b")
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	okm, err := hkdfSHA256(ikm, salt, info, 42)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865", hex.EncodeToString(okm), "Output should match the RFC")
+}
+
+func TestEncryptDecryptMessage(tst *testing.T) {
+	key := "01234567890~!@#$%^&*-_=+ABCabc"
+	message := `{"customer": "Jane Doe", "ssn": "123-45-6789"}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	encrypted, err := EncryptMessage(key, message, now)
+	assert.Nil(tst, err, "No error")
+	assert.False(tst, strings.Contains(string(encrypted), "Jane"), "Message should not be readable")
+
+	again, _ := EncryptMessage(key, message, now)
+	assert.NotEqual(tst, string(encrypted), string(again), "Each encryption should differ")
+
+	decrypted, err := DecryptMessage(key, encrypted, 30)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, message, decrypted, "Message should round trip")
+
+	_, err = DecryptMessage("wrong key", encrypted, 30)
+	assert.NotNil(tst, err, "Wrong key should fail")
+
+	// Altered envelopes
+	var env map[string]interface{}
+	json.Unmarshal(encrypted, &env)
+	env["v"] = 2
+	altered, _ := json.Marshal(env)
+	_, err = DecryptMessage(key, altered, 30)
+	assert.NotNil(tst, err, "Unknown version should fail")
+
+	json.Unmarshal(encrypted, &env)
+	env["salt"] = "AAAAAAAAAAAAAAAAAAAAAA=="
+	altered, _ = json.Marshal(env)
+	_, err = DecryptMessage(key, altered, 30)
+	assert.NotNil(tst, err, "Altered salt should fail")
+
+	// Timestamp window
+	encrypted, _ = EncryptMessage(key, message, strconv.FormatInt(time.Now().Unix()-60, 10))
+	_, err = DecryptMessage(key, encrypted, 30)
+	assert.NotNil(tst, err, "Expired message should fail")
+}
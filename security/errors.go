@@ -0,0 +1,63 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Errors returned by the security package.  Check for them with errors.Is, ex: errors.Is(err, security.ErrExpired),
+// rather than matching the message.  Use errors.As with *ExpiredError or *MalformedError for the details.
+var (
+	ErrMalformedEnvelope = errors.New("Security error- Malformed envelope")
+	ErrBadSignature      = errors.New("Security error- Invalid signature")
+	ErrExpired           = errors.New("Security error- Invalid timestamp")
+	ErrUnknownGroup      = errors.New("Security error- Invalid group name")
+	ErrReplayed          = errors.New("Security error- Nonce already used")
+	ErrNoCredential      = errors.New("Security error- No valid key for group")
+)
+
+// ExpiredError is returned when a timestamp is outside of the verifyTimeout window.  It matches ErrExpired.
+type ExpiredError struct {
+	Skew    time.Duration // the current time minus the timestamp; negative if the timestamp is in the future
+	Timeout time.Duration // the verifyTimeout allowed either way
+}
+
+func (e *ExpiredError) Error() string {
+	return "Security error- Invalid timestamp (" + strconv.FormatInt(int64(e.Skew/time.Second), 10) +
+		") outside of verifyTime (+/- " + strconv.FormatInt(int64(e.Timeout/time.Second), 10) + ")"
+}
+
+// Is lets errors.Is(err, ErrExpired) match
+func (e *ExpiredError) Is(target error) bool {
+	return target == ErrExpired
+}
+
+// MalformedError is returned when a message, token or header can't be parsed.  It matches ErrMalformedEnvelope.
+// Detail names the part that was malformed; it never includes the received data.
+type MalformedError struct {
+	Detail string
+	Err    error // the parse error, if any
+}
+
+func (e *MalformedError) Error() string {
+	return ErrMalformedEnvelope.Error() + " (" + e.Detail + ")"
+}
+
+// Is lets errors.Is(err, ErrMalformedEnvelope) match
+func (e *MalformedError) Is(target error) bool {
+	return target == ErrMalformedEnvelope
+}
+
+// Unwrap returns the parse error
+func (e *MalformedError) Unwrap() error {
+	return e.Err
+}
+
+func malformed(detail string, err error) error {
+	return &MalformedError{Detail: detail, Err: err}
+}
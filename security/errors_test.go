@@ -0,0 +1,106 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeHMACErrors(tst *testing.T) {
+	key := "01234567890~!@#$%^&*-_=+ABCabc"
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	_, err := DecodeHMAC(key, []byte("not json"), 30)
+	assert.True(tst, errors.Is(err, ErrMalformedEnvelope), "Garbage should be malformed")
+	var malformedErr *MalformedError
+	assert.True(tst, errors.As(err, &malformedErr), "Should be a MalformedError")
+	assert.Equal(tst, "envelope", malformedErr.Detail, "Detail should name the envelope")
+
+	// Tamper with the signature; the error and returned string must not echo it back
+	encoded, _ := EncodeHMAC(key, "hello", now)
+	var env map[string]string
+	json.Unmarshal(encoded, &env)
+	env["signature"] = base64.URLEncoding.EncodeToString([]byte(strings.Repeat("ab", 64)))
+	tampered, _ := json.Marshal(env)
+	decoded, err := DecodeHMAC(key, tampered, 30)
+	assert.True(tst, errors.Is(err, ErrBadSignature), "Tampered signature should be a bad signature")
+	assert.False(tst, errors.Is(err, ErrMalformedEnvelope), "Tampered signature is not malformed")
+	assert.Equal(tst, "Error verifying hmac", decoded, "Should only describe the failed step")
+	assert.NotContains(tst, err.Error(), "abab", "Error should not contain the signature")
+
+	_, err = DecodeHMAC("wrong key", encoded, 30)
+	assert.True(tst, errors.Is(err, ErrBadSignature), "Wrong key should be a bad signature")
+
+	// Expired either way, with the skew available through errors.As
+	old, _ := EncodeHMAC(key, "hello", strconv.FormatInt(time.Now().Unix()-60, 10))
+	_, err = DecodeHMAC(key, old, 30)
+	assert.True(tst, errors.Is(err, ErrExpired), "Old message should be expired")
+	var expired *ExpiredError
+	assert.True(tst, errors.As(err, &expired), "Should be an ExpiredError")
+	assert.True(tst, expired.Skew >= 60*time.Second, "Skew should be positive for an old message")
+	assert.Equal(tst, 30*time.Second, expired.Timeout, "Timeout should be reported")
+
+	future, _ := EncodeHMAC(key, "hello", strconv.FormatInt(time.Now().Unix()+60, 10))
+	_, err = DecodeHMAC(key, future, 30)
+	assert.True(tst, errors.As(err, &expired), "Should be an ExpiredError")
+	assert.True(tst, expired.Skew < 0, "Skew should be negative for a future message")
+
+	notANumber, _ := EncodeHMAC(key, "hello", "yesterday")
+	_, err = DecodeHMAC(key, notANumber, 30)
+	assert.True(tst, errors.Is(err, ErrMalformedEnvelope), "Unparseable timestamp should be malformed")
+
+	// Replays
+	store := NewMemoryNonceStore(10)
+	nonce, _ := NewNonce()
+	encoded, _ = EncodeHMACWithNonce(key, "hello", now, nonce)
+	_, err = DecodeHMACWithNonce(key, encoded, 30, store)
+	assert.Nil(tst, err, "First use should decode")
+	_, err = DecodeHMACWithNonce(key, encoded, 30, store)
+	assert.True(tst, errors.Is(err, ErrReplayed), "Second use should be replayed")
+}
+
+func TestTypedErrors(tst *testing.T) {
+	groups := []config.SecurityGroups{{Name: "test01", Hmackey: "01234567890~!@#$%^&*-_=+ABCabc"}}
+
+	_, err := GetKeyFromGroup("nogroup", &groups)
+	assert.True(tst, errors.Is(err, ErrUnknownGroup), "Missing group should be unknown")
+
+	// Signed requests
+	req, _ := http.NewRequest("GET", "http://localhost:8888/request/v1/test", nil)
+	_, err = VerifyRequest(req, &groups, 30)
+	assert.True(tst, errors.Is(err, ErrMalformedEnvelope), "Unsigned request should be malformed")
+	SignRequest(req, "test01", "not the key", nil, strconv.FormatInt(time.Now().Unix(), 10))
+	_, err = VerifyRequest(req, &groups, 30)
+	assert.True(tst, errors.Is(err, ErrBadSignature), "Wrong key should be a bad signature")
+	SignRequest(req, "nogroup", "key", nil, strconv.FormatInt(time.Now().Unix(), 10))
+	_, err = VerifyRequest(req, &groups, 30)
+	assert.True(tst, errors.Is(err, ErrUnknownGroup), "Unknown group should be unknown")
+
+	// Tokens
+	cfg := jwtTestConfig(tst, `{"signingKey": "0123456789abcdef0123456789abcdef", "lifetimeSec": 1, "clockSkewSec": 0}`)
+	_, err = VerifyToken(cfg, "a.b")
+	assert.True(tst, errors.Is(err, ErrMalformedEnvelope), "Token without three parts should be malformed")
+	token, err := IssueToken(cfg, "browser")
+	assert.Nil(tst, err, "No error")
+	_, err = VerifyToken(cfg, token[:len(token)-4]+"AAAA")
+	assert.True(tst, errors.Is(err, ErrBadSignature), "Altered token should be a bad signature")
+
+	// Encrypted messages
+	encrypted, _ := EncryptMessage("key", "hello", strconv.FormatInt(time.Now().Unix(), 10))
+	_, err = DecryptMessage("other key", encrypted, 30)
+	assert.True(tst, errors.Is(err, ErrBadSignature), "Wrong key should fail authentication")
+	_, err = DecryptMessage("key", []byte(`{"v": 99}`), 30)
+	assert.True(tst, errors.Is(err, ErrMalformedEnvelope), "Unknown version should be malformed")
+}
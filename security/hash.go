@@ -0,0 +1,98 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// argon2id parameters used by HashKey, the OWASP minimum (19 MiB, 2 passes, 1 thread)
+const (
+	argon2Memory  = 19 * 1024
+	argon2Time    = 2
+	argon2Threads = 1
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// HashKey returns an argon2id hash of key in the standard encoded form,
+// ex: $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>, for use as a group's hmackey with simple auth
+func HashKey(key string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", err
+	}
+	hash := argon2.IDKey([]byte(key), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// HashKeyBcrypt returns a bcrypt hash of key, for use as a group's hmackey with simple auth.  cost 0 uses bcrypt.DefaultCost.
+func HashKeyBcrypt(key string, cost int) (string, error) {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(key), cost)
+	return string(hash), err
+}
+
+// VerifyKey reports whether key matches stored, which is an argon2id or bcrypt hash or, for older configs, the plaintext key.
+// The comparison takes the same time however much of the key matches.  Hashes are computed on every call, with nothing
+// remembered that could be used to test guesses quickly, so each simple auth request with a hashed key costs one hash.
+func VerifyKey(stored string, key string) bool {
+	if !config.IsHashedKey(stored) {
+		// Compare digests so the time doesn't depend on the lengths either
+		a := sha256.Sum256([]byte(stored))
+		b := sha256.Sum256([]byte(key))
+		return hmac.Equal(a[:], b[:])
+	}
+
+	if strings.HasPrefix(stored, "$argon2id$") {
+		return verifyArgon2id(stored, key)
+	}
+	return bcrypt.CompareHashAndPassword([]byte(stored), []byte(key)) == nil
+}
+
+// verifyArgon2id checks key against an encoded argon2id hash, using the parameters stored in it
+func verifyArgon2id(stored string, key string) bool {
+	salt, hash, version, memory, time, threads, err := parseArgon2id(stored)
+	if err != nil || version != argon2.Version || time == 0 || threads == 0 {
+		return false
+	}
+	computed := argon2.IDKey([]byte(key), salt, time, memory, threads, uint32(len(hash)))
+	return subtle.ConstantTimeCompare(hash, computed) == 1
+}
+
+func parseArgon2id(stored string) (salt []byte, hash []byte, version int, memory uint32, time uint32, threads uint8, err error) {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return nil, nil, 0, 0, 0, 0, errors.New("Security error- Malformed argon2id hash")
+	}
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, 0, 0, 0, 0, errors.New("Security error- Malformed argon2id hash")
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return nil, nil, 0, 0, 0, 0, errors.New("Security error- Malformed argon2id hash")
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, nil, 0, 0, 0, 0, errors.New("Security error- Malformed argon2id hash")
+	}
+	if hash, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(hash) == 0 {
+		return nil, nil, 0, 0, 0, 0, errors.New("Security error- Malformed argon2id hash")
+	}
+	return salt, hash, version, memory, time, threads, nil
+}
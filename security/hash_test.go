@@ -0,0 +1,49 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"strings"
+	"testing"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashKey(tst *testing.T) {
+	hash, err := HashKey("01234567890~!@#$%^&*-_=+ABCabc")
+	assert.Nil(tst, err, "No error")
+	assert.True(tst, strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$"), "Hash should be in the encoded argon2id form")
+	assert.True(tst, config.IsHashedKey(hash), "Config should recognize the hash")
+	assert.True(tst, VerifyKey(hash, "01234567890~!@#$%^&*-_=+ABCabc"), "Right key should verify")
+	assert.True(tst, VerifyKey(hash, "01234567890~!@#$%^&*-_=+ABCabc"), "Right key should verify again")
+	assert.False(tst, VerifyKey(hash, "01234567890~!@#$%^&*-_=+ABCabd"), "Wrong key should not verify")
+
+	bhash, err := HashKeyBcrypt("secret", 4)
+	assert.Nil(tst, err, "No error")
+	assert.True(tst, config.IsHashedKey(bhash), "Config should recognize the bcrypt hash")
+	assert.True(tst, VerifyKey(bhash, "secret"), "Right key should verify")
+	assert.False(tst, VerifyKey(bhash, "secret2"), "Wrong key should not verify")
+
+	assert.True(tst, VerifyKey("plaintext", "plaintext"), "Plaintext keys still work")
+	assert.False(tst, VerifyKey("plaintext", "plaintext2"), "Wrong plaintext key should not verify")
+	assert.False(tst, VerifyKey("$argon2id$v=19$m=19456,t=0,p=0$AAAA$AAAA", "x"), "Malformed hash should not verify")
+	assert.False(tst, VerifyKey("$argon2id$garbage", "x"), "Malformed hash should not verify")
+}
+
+func TestAuthenticateGroupHashed(tst *testing.T) {
+	hash, _ := HashKey("hashedkey")
+	pub, _, _ := GenerateEd25519Key()
+	groups := []config.SecurityGroups{
+		{Name: "hashed", Hmackey: hash},
+		{Name: "rotating", Keys: []config.GroupKey{{ID: "a", Key: "oldkey", Status: config.KeyStatusRevoked}, {ID: "b", Key: "newkey"}}},
+		{Name: "partner", Algorithm: config.AlgEdDSA, Hmackey: pub},
+	}
+	assert.True(tst, AuthenticateGroup("hashed", "hashedkey", &groups), "Hashed key should authenticate")
+	assert.False(tst, AuthenticateGroup("hashed", hash, &groups), "The hash itself should not authenticate")
+	assert.True(tst, AuthenticateGroup("rotating", "newkey", &groups), "Active key should authenticate")
+	assert.False(tst, AuthenticateGroup("rotating", "oldkey", &groups), "Revoked key should not authenticate")
+	assert.False(tst, AuthenticateGroup("partner", pub, &groups), "Public keys should not authenticate")
+}
@@ -0,0 +1,213 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+)
+
+// TokenClaims are the claims in a token from IssueToken
+type TokenClaims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub"` // the group name
+	Audience  string   `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	IssuedAt  int64    `json:"iat"`
+	ID        string   `json:"jti"`
+	Group     string   `json:"group"`
+	APICalls  []string `json:"apiCalls"` // the api calls the group may make, from AllowedAPICalls
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// requestPath is the engine url of an api call, less its name
+const requestPath = "/request/"
+
+// AllowedAPICalls returns the names of the api calls that Authorize allows group to make, sorted.
+// Each call is checked at the url the engine authorizes, "/request/" + its name, so handler, pattern and regex rules apply.
+func AllowedAPICalls(cfg *config.Config, group string) []string {
+	calls := []string{}
+	for name := range cfg.APICalls {
+		if allowed, _ := Authorize(cfg, group, requestPath+name); allowed {
+			calls = append(calls, name)
+		}
+	}
+	sort.Strings(calls)
+	return calls
+}
+
+// IssueToken returns a signed JWT for group, valid for security > jwt > lifetimeSec.
+// Only call it once the group has been authenticated, ex: by AuthenticateGroup or DecodeHMAC;
+// AuthenticateAndIssueToken does both for simple auth.
+func IssueToken(cfg *config.Config, group string) (string, error) {
+	return IssueTokenWithStore(cfg, NewConfigCredentialStore(&cfg.Security.Groups), group)
+}
+
+// IssueTokenWithStore is IssueToken for a group whose credentials are kept in store rather than security > groups
+func IssueTokenWithStore(cfg *config.Config, store CredentialStore, group string) (string, error) {
+	if err := checkGroupKeys(store, group); err != nil {
+		return "", err
+	}
+	signer, err := jwtSigner(cfg.Security.JWT)
+	if err != nil {
+		return "", err
+	}
+	jti, err := NewNonce()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().Unix()
+	claims := TokenClaims{
+		Issuer:    cfg.Security.JWT.Issuer,
+		Subject:   group,
+		Audience:  cfg.Security.JWT.Audience,
+		ExpiresAt: now + cfg.Security.JWT.LifetimeSec,
+		NotBefore: now,
+		IssuedAt:  now,
+		ID:        jti,
+		Group:     group,
+		APICalls:  AllowedAPICalls(cfg, group),
+	}
+
+	header, err := json.Marshal(tokenHeader{Alg: signer.Algorithm(), Typ: "JWT", Kid: cfg.Security.JWT.KeyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := signer.Sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// AuthenticateAndIssueToken checks group and key with AuthenticateGroup, then issues a token for the group
+func AuthenticateAndIssueToken(cfg *config.Config, group string, key string) (string, error) {
+	if !AuthenticateGroup(group, key, &cfg.Security.Groups) {
+		return "", errors.New("Security error- Invalid group or key")
+	}
+	return IssueToken(cfg, group)
+}
+
+// VerifyToken checks a token from IssueToken and returns its claims.  The algorithm must be the configured one,
+// exp, nbf and iat are checked allowing security > jwt > clockSkewSec, iss and aud must match the config,
+// and the group must still exist with a key that may verify.
+func VerifyToken(cfg *config.Config, token string) (*TokenClaims, error) {
+	return VerifyTokenWithStore(cfg, NewConfigCredentialStore(&cfg.Security.Groups), token)
+}
+
+// VerifyTokenWithStore is VerifyToken checking the group against store, so a token stops verifying as soon as
+// its group's credentials are revoked there, ex: with FileCredentialStore.Revoke
+func VerifyTokenWithStore(cfg *config.Config, store CredentialStore, token string) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, malformed("token", nil)
+	}
+
+	var header tokenHeader
+	if err := decodeTokenPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signer, err := jwtSigner(cfg.Security.JWT)
+	if err != nil {
+		return nil, err
+	}
+	if header.Alg != signer.Algorithm() {
+		return nil, fmt.Errorf("%w (unexpected token algorithm %s)", ErrBadSignature, header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, malformed("token signature", err)
+	}
+	if !verifierFor(signer).Verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrBadSignature
+	}
+
+	var claims TokenClaims
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	skew := cfg.Security.JWT.ClockSkewSec
+	if now > claims.ExpiresAt+skew {
+		return nil, &ExpiredError{Skew: time.Duration(now-claims.ExpiresAt) * time.Second, Timeout: time.Duration(skew) * time.Second}
+	}
+	if now < claims.NotBefore-skew || now < claims.IssuedAt-skew {
+		return nil, &ExpiredError{Skew: time.Duration(now-claims.NotBefore) * time.Second, Timeout: time.Duration(skew) * time.Second}
+	}
+	if cfg.Security.JWT.Issuer != "" && claims.Issuer != cfg.Security.JWT.Issuer {
+		return nil, errors.New("Security error- Invalid token issuer")
+	}
+	if cfg.Security.JWT.Audience != "" && claims.Audience != cfg.Security.JWT.Audience {
+		return nil, errors.New("Security error- Invalid token audience")
+	}
+	if err := checkGroupKeys(store, claims.Group); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// checkGroupKeys returns ErrUnknownGroup if store doesn't have group, or ErrNoCredential if none of its credentials
+// may verify, whatever their algorithm, so tokens stop working once a group is removed or its keys revoked
+func checkGroupKeys(store CredentialStore, group string) error {
+	creds, err := store.Credentials(group)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, c := range creds {
+		if c.CanVerify(now) {
+			return nil
+		}
+	}
+	return ErrNoCredential
+}
+
+// jwtSigner returns the signer for security > jwt
+func jwtSigner(jwt config.JWTConfig) (Signer, error) {
+	if jwt.SigningKey == "" {
+		return nil, errors.New("Security error- No jwt signingKey configured")
+	}
+	return NewSigner(jwt.Algorithm, jwt.SigningKey)
+}
+
+// verifierFor returns the Verifier matching signer.  HMAC signers verify themselves; Ed25519 uses the public half of the key.
+func verifierFor(signer Signer) Verifier {
+	if s, ok := signer.(*ed25519Signer); ok {
+		return &ed25519Verifier{key: s.key.Public().(ed25519.PublicKey)}
+	}
+	return signer.(Verifier)
+}
+
+func decodeTokenPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return malformed("token", err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return malformed("token", err)
+	}
+	return nil
+}
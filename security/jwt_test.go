@@ -0,0 +1,164 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func jwtTestConfig(tst *testing.T, jwt string) *config.Config {
+	cfg, err := config.DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	cfg, err = config.CustomizeConfig(cfg, `{
+		"security": {
+			"groups": [{"name": "browser", "hmackey": "browserkey"}, {"name": "other", "hmackey": "otherkey"}],
+			"handlerAccess": [{"apiCall": "v1/admin", "allowGroups": ["other"]}],
+			"jwt": `+jwt+`
+		},
+		"apiCalls": {"v1/public": {}, "v1/admin": {}}
+	}`)
+	assert.Nil(tst, err, "No error")
+	return cfg
+}
+
+func TestIssueVerifyToken(tst *testing.T) {
+	cfg := jwtTestConfig(tst, `{"signingKey": "0123456789abcdef0123456789abcdef", "keyId": "j1", "audience": "web"}`)
+
+	_, err := AuthenticateAndIssueToken(cfg, "browser", "wrongkey")
+	assert.NotNil(tst, err, "Wrong key should not get a token")
+
+	token, err := AuthenticateAndIssueToken(cfg, "browser", "browserkey")
+	assert.Nil(tst, err, "No error")
+
+	var header map[string]string
+	b, _ := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	json.Unmarshal(b, &header)
+	assert.Equal(tst, map[string]string{"alg": "HS512", "typ": "JWT", "kid": "j1"}, header, "Header should name the algorithm and key")
+
+	claims, err := VerifyToken(cfg, token)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, "browser", claims.Group, "Group should be carried")
+	assert.Equal(tst, []string{"v1/public"}, claims.APICalls, "Only allowed api calls should be carried")
+
+	// Rules match the url the engine checks
+	cfg.Security.HandlerAccess = append(cfg.Security.HandlerAccess,
+		config.HandlerAccess{HandlerURL: "/request/v1/public", DenyGroups: []string{"browser"}},
+		config.HandlerAccess{Pattern: "/request/v1/*", AllowGroups: []string{"browser"}})
+	assert.Equal(tst, []string{}, AllowedAPICalls(cfg, "browser"), "Handler rule should deny v1/public")
+	assert.Equal(tst, []string{"v1/admin"}, AllowedAPICalls(cfg, "other"), "Pattern rule should deny v1/public")
+	cfg.Security.HandlerAccess = cfg.Security.HandlerAccess[:1]
+	assert.Equal(tst, "bolt", claims.Issuer, "Default issuer")
+	assert.Equal(tst, int64(300), claims.ExpiresAt-claims.IssuedAt, "Default lifetime")
+
+	// Tampered claims
+	parts := strings.Split(token, ".")
+	forged, _ := json.Marshal(TokenClaims{Subject: "other", Group: "other", ExpiresAt: time.Now().Unix() + 300, Issuer: "bolt", Audience: "web"})
+	_, err = VerifyToken(cfg, parts[0]+"."+base64.RawURLEncoding.EncodeToString(forged)+"."+parts[2])
+	assert.NotNil(tst, err, "Tampered token should fail")
+
+	// alg none
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	_, err = VerifyToken(cfg, none+"."+parts[1]+".")
+	assert.NotNil(tst, err, "Unsigned token should fail")
+
+	// Audience and issuer
+	other := jwtTestConfig(tst, `{"signingKey": "0123456789abcdef0123456789abcdef", "audience": "mobile"}`)
+	_, err = VerifyToken(other, token)
+	assert.NotNil(tst, err, "Wrong audience should fail")
+	other = jwtTestConfig(tst, `{"signingKey": "0123456789abcdef0123456789abcdef", "audience": "web", "issuer": "elsewhere"}`)
+	_, err = VerifyToken(other, token)
+	assert.NotNil(tst, err, "Wrong issuer should fail")
+}
+
+func TestVerifyTokenExpiry(tst *testing.T) {
+	cfg := jwtTestConfig(tst, `{"signingKey": "0123456789abcdef0123456789abcdef", "lifetimeSec": 1, "clockSkewSec": 0}`)
+	token, err := IssueToken(cfg, "browser")
+	assert.Nil(tst, err, "No error")
+
+	cfg.Security.JWT.LifetimeSec = -10
+	expired, _ := IssueToken(cfg, "browser")
+	_, err = VerifyToken(cfg, expired)
+	assert.NotNil(tst, err, "Expired token should fail")
+
+	cfg.Security.JWT.ClockSkewSec = 30
+	_, err = VerifyToken(cfg, expired)
+	assert.Nil(tst, err, "Clock skew should allow a recently expired token")
+
+	_, err = VerifyToken(cfg, token)
+	assert.Nil(tst, err, "Current token should verify")
+
+	_, err = IssueToken(cfg, "nogroup")
+	assert.NotNil(tst, err, "Unknown group should not get a token")
+}
+
+func TestIssueVerifyTokenEdDSA(tst *testing.T) {
+	_, priv, _ := GenerateEd25519Key()
+	cfg := jwtTestConfig(tst, `{"algorithm": "EdDSA", "signingKey": "`+priv+`"}`)
+
+	token, err := IssueToken(cfg, "browser")
+	assert.Nil(tst, err, "No error")
+	claims, err := VerifyToken(cfg, token)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, "browser", claims.Subject, "Subject is the group")
+
+	_, err = VerifyToken(jwtTestConfig(tst, `{"signingKey": "0123456789abcdef0123456789abcdef"}`), token)
+	assert.NotNil(tst, err, "EdDSA token should fail when HS512 is configured")
+}
+
+func TestIssueTokenGroupKeys(tst *testing.T) {
+	cfg := jwtTestConfig(tst, `{"signingKey": "0123456789abcdef0123456789abcdef"}`)
+	pub, _, _ := GenerateEd25519Key()
+	hashed, _ := HashKey("simplekey")
+	cfg.Security.Groups = []config.SecurityGroups{
+		{Name: "partner", Algorithm: config.AlgEdDSA, Hmackey: pub},
+		{Name: "simple", Hmackey: hashed},
+		{Name: "revoked", Keys: []config.GroupKey{{ID: "a", Key: "akey", Status: config.KeyStatusRevoked}}},
+	}
+
+	// Groups without an hmac key can still be issued tokens
+	for _, group := range []string{"partner", "simple"} {
+		token, err := IssueToken(cfg, group)
+		assert.Nil(tst, err, "No error for "+group)
+		_, err = VerifyToken(cfg, token)
+		assert.Nil(tst, err, "No error for "+group)
+	}
+	_, err := IssueToken(cfg, "revoked")
+	assert.True(tst, errors.Is(err, ErrNoCredential), "Group with every key revoked gets no token")
+	_, err = IssueToken(cfg, "nogroup")
+	assert.True(tst, errors.Is(err, ErrUnknownGroup), "Unknown group gets no token")
+}
+
+func TestVerifyTokenWithStore(tst *testing.T) {
+	cfg := jwtTestConfig(tst, `{"signingKey": "0123456789abcdef0123456789abcdef"}`)
+	dir, err := ioutil.TempDir("", "boltjwt")
+	assert.Nil(tst, err, "No error")
+	defer os.RemoveAll(dir)
+	store, err := NewFileCredentialStore(filepath.Join(dir, "credentials.json"), config.AuthModeHMAC)
+	assert.Nil(tst, err, "No error")
+	assert.Nil(tst, store.Put(Credential{Group: "web", GroupKey: config.GroupKey{ID: "k1", Key: "01234567890~!@#$%^&*-_=+webkey"}}), "No error")
+
+	token, err := IssueTokenWithStore(cfg, store, "web")
+	assert.Nil(tst, err, "Group in the store gets a token")
+	claims, err := VerifyTokenWithStore(cfg, store, token)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, "web", claims.Group, "Group should be the subject")
+
+	assert.Nil(tst, store.Revoke("web", "k1"), "No error")
+	_, err = VerifyTokenWithStore(cfg, store, token)
+	assert.True(tst, errors.Is(err, ErrNoCredential), "Token stops verifying once the group's key is revoked")
+	_, err = IssueTokenWithStore(cfg, store, "web")
+	assert.True(tst, errors.Is(err, ErrNoCredential), "Revoked group gets no token")
+}
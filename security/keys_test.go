@@ -0,0 +1,65 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeDecodeHMACForGroup(tst *testing.T) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	future := time.Now().Add(time.Hour)
+	group := config.SecurityGroups{
+		Name: "rotating",
+		Keys: []config.GroupKey{
+			{ID: "old", Key: "oldkey", Status: config.KeyStatusVerifyOnly},
+			{ID: "new", Key: "newkey"},
+			{ID: "next", Key: "nextkey", NotBefore: &future},
+			{ID: "leaked", Key: "leakedkey", Status: config.KeyStatusRevoked},
+		},
+	}
+
+	encoded, err := EncodeHMACForGroup(group, "hello", now, "")
+	assert.Nil(tst, err, "No error")
+	var env map[string]string
+	json.Unmarshal(encoded, &env)
+	assert.Equal(tst, "new", env["kid"], "The active key's id should be sent")
+
+	decoded, kid, err := DecodeHMACForGroup(group, encoded, 30)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, "hello", decoded, "Message should decode")
+	assert.Equal(tst, "new", kid, "The kid's key verified it")
+
+	// A client still on the old key, without a kid
+	encoded, _ = EncodeHMAC("oldkey", "hello", now)
+	decoded, kid, err = DecodeHMACForGroup(group, encoded, 30)
+	assert.Nil(tst, err, "Verify-only key should still verify")
+	assert.Equal(tst, "old", kid, "The old key verified it")
+
+	// A wrong kid falls back to the other keys
+	encoded, _ = EncodeWithSigner(newHMACSigner(config.AlgHS512, "newkey"), "old", "hello", now, "")
+	_, kid, err = DecodeHMACForGroup(group, encoded, 30)
+	assert.Nil(tst, err, "Fall back when the kid's key doesn't match")
+	assert.Equal(tst, "new", kid, "The new key verified it")
+
+	encoded, _ = EncodeWithSigner(newHMACSigner(config.AlgHS512, "leakedkey"), "leaked", "hello", now, "")
+	_, _, err = DecodeHMACForGroup(group, encoded, 30)
+	assert.NotNil(tst, err, "Revoked key should not verify")
+
+	encoded, _ = EncodeWithSigner(newHMACSigner(config.AlgHS512, "nextkey"), "next", "hello", now, "")
+	_, _, err = DecodeHMACForGroup(group, encoded, 30)
+	assert.NotNil(tst, err, "Key before its notBefore should not verify")
+
+	encoded, _ = EncodeHMACForGroup(group, "hello", strconv.FormatInt(time.Now().Unix()-60, 10), "")
+	decoded, _, err = DecodeHMACForGroup(group, encoded, 30)
+	assert.NotNil(tst, err, "Expired message should fail")
+	assert.Equal(tst, "Error verifying time", decoded, "Expired message should report the time")
+}
@@ -0,0 +1,215 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+)
+
+// Headers read by Middleware.  Every request names its group in HeaderGroup.  With simple auth the group's key
+// is sent in HeaderKey and the body is passed through as the message; with hmac auth the body is the json from
+// EncodeHMAC (or EncodeHMACForGroup, EncodeWithSigner) signed with the group's key.
+const (
+	HeaderGroup = "X-Bolt-Group"
+	HeaderKey   = "X-Bolt-Key"
+)
+
+// DefaultMaxBodyBytes is the largest request body Middleware reads unless MiddlewareOptions.MaxBodyBytes is set
+const DefaultMaxBodyBytes = 1 << 20
+
+// DefaultAuthLimit is the rate of requests Middleware lets each client IP attempt before authenticating them,
+// unless MiddlewareOptions.AuthLimit is set.  It keeps unauthenticated callers from making the engine hash keys without limit.
+var DefaultAuthLimit = Limit{Rate: 100, Burst: 200}
+
+// MiddlewareOptions configures Middleware.  The zero value is usable.
+type MiddlewareOptions struct {
+	Credentials  CredentialStore              // the groups' keys, security > groups if nil
+	Verifier     *MessageVerifier             // decodes hmac messages, NewMessageVerifierWithStore(cfg, Credentials) if nil.  Set its Nonces to reject replays.
+	RateLimiter  *RateLimiter                 // limits each group, NewRateLimiter(cfg, nil) if nil
+	AuthLimit    Limit                        // limits each client IP before authentication, in RateLimiter's store; DefaultAuthLimit if zero, none if Rate is negative.  Burst is Rate if 0.
+	MaxBodyBytes int64                        // DefaultMaxBodyBytes if 0
+	ClientIP     func(r *http.Request) string // the ip used by groups with rateLimitPerIP, the host of r.RemoteAddr if nil
+}
+
+// MiddlewareError is the json body of every error response written by Middleware
+type MiddlewareError struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+type contextKey int
+
+const (
+	groupContextKey contextKey = iota
+	messageContextKey
+)
+
+// Middleware authenticates requests using engine > authMode, checks the group may access the request path with Authorize,
+// and applies the group's rate limit, before calling next.  Each client IP is limited by AuthLimit before authentication.
+// The authenticated group and decoded message are available to next from GroupFromContext and MessageFromContext;
+// the request body can still be read as sent.
+// Failures are answered with a json MiddlewareError: 400 for a missing group or malformed message, 401 if authentication fails,
+// 403 if handlerAccess denies the group, 413 for an oversized body, 429, with Retry-After, when rate limited,
+// and 503 if the group's nonces fill the verifier's NonceStore.
+// It panics if engine > authMode isn't valid, since requests could otherwise be checked the wrong way,
+// or if AuthLimit has a Burst but a zero Rate, since its buckets would never refill.
+func Middleware(cfg *config.Config, opts MiddlewareOptions) func(next http.Handler) http.Handler {
+	authMode, err := config.ParseAuthMode(cfg.Engine.AuthMode)
+	if err != nil {
+		panic(err)
+	}
+	if opts.Credentials == nil {
+		opts.Credentials = NewConfigCredentialStore(&cfg.Security.Groups)
+	}
+	if opts.Verifier == nil {
+		opts.Verifier = NewMessageVerifierWithStore(cfg, opts.Credentials)
+	}
+	if opts.RateLimiter == nil {
+		opts.RateLimiter = NewRateLimiter(cfg, nil)
+	}
+	if opts.AuthLimit == (Limit{}) {
+		opts.AuthLimit = DefaultAuthLimit
+	}
+	if opts.AuthLimit.Rate == 0 {
+		panic("Security error- MiddlewareOptions.AuthLimit needs a positive Rate, or a negative Rate for no limit")
+	}
+	if opts.AuthLimit.Burst <= 0 {
+		opts.AuthLimit.Burst = int64(math.Ceil(opts.AuthLimit.Rate))
+	}
+	if opts.MaxBodyBytes == 0 {
+		opts.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if opts.ClientIP == nil {
+		opts.ClientIP = remoteIP
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			group := r.Header.Get(HeaderGroup)
+			if group == "" {
+				writeMiddlewareError(w, http.StatusBadRequest, "Security error- Missing "+HeaderGroup+" header")
+				return
+			}
+
+			clientIP := opts.ClientIP(r)
+			if opts.AuthLimit.Rate > 0 {
+				if allowed, retryAfter := opts.RateLimiter.allowKey(authLimitKey+clientIP, opts.AuthLimit); !allowed {
+					writeRateLimited(w, retryAfter)
+					return
+				}
+			}
+
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, opts.MaxBodyBytes)
+			}
+			body, err := readBody(r, opts.MaxBodyBytes)
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					writeMiddlewareError(w, http.StatusRequestEntityTooLarge, "Security error- Request body too large")
+					return
+				}
+				writeMiddlewareError(w, http.StatusBadRequest, "Security error- Unable to read request body")
+				return
+			}
+
+			var message string
+			switch authMode {
+			case config.AuthModeSimple:
+				if !AuthenticateWithStore(opts.Credentials, group, r.Header.Get(HeaderKey)) {
+					writeMiddlewareError(w, http.StatusUnauthorized, "Security error- Invalid group or key")
+					return
+				}
+				message = string(body)
+			default:
+				var kid string
+				message, kid, err = opts.Verifier.Decode(group, body)
+				if err != nil {
+					writeSecurityError(w, err)
+					return
+				}
+				clock := opts.Verifier.Clock
+				if clock == nil {
+					clock = SystemClock
+				}
+				opts.Credentials.MarkUsed(group, kid, clock.Now())
+			}
+
+			if allowed, _ := Authorize(cfg, group, r.URL.Path); !allowed {
+				writeMiddlewareError(w, http.StatusForbidden, "Security error- Group "+group+" may not access "+r.URL.Path)
+				return
+			}
+
+			if allowed, retryAfter := opts.RateLimiter.Allow(group, clientIP); !allowed {
+				writeRateLimited(w, retryAfter)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), groupContextKey, group)
+			ctx = context.WithValue(ctx, messageContextKey, message)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GroupFromContext returns the group authenticated by Middleware
+func GroupFromContext(ctx context.Context) (group string, ok bool) {
+	group, ok = ctx.Value(groupContextKey).(string)
+	return group, ok
+}
+
+// MessageFromContext returns the message decoded by Middleware
+func MessageFromContext(ctx context.Context) (message string, ok bool) {
+	message, ok = ctx.Value(messageContextKey).(string)
+	return message, ok
+}
+
+// writeSecurityError answers with the status for an error from MessageVerifier.Decode
+func writeSecurityError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrMalformedEnvelope):
+		writeMiddlewareError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrUnknownGroup):
+		// Don't tell the client whether the group exists
+		writeMiddlewareError(w, http.StatusUnauthorized, ErrBadSignature.Error())
+	case errors.Is(err, ErrBadSignature), errors.Is(err, ErrExpired), errors.Is(err, ErrReplayed):
+		writeMiddlewareError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, ErrNonceStoreFull):
+		// Only this group is affected, until its nonces expire
+		writeMiddlewareError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		writeMiddlewareError(w, http.StatusInternalServerError, "Security error- Unable to verify request")
+	}
+}
+
+// writeRateLimited answers with 429 and a Retry-After in whole seconds
+func writeRateLimited(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+	writeMiddlewareError(w, http.StatusTooManyRequests, "Security error- Rate limit exceeded")
+}
+
+func writeMiddlewareError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(MiddlewareError{Status: status, Error: message})
+}
+
+// remoteIP returns the host of r.RemoteAddr
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
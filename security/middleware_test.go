@@ -0,0 +1,215 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func middlewareTestConfig(tst *testing.T, authMode string) *config.Config {
+	cfg, err := config.DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	cfg.Engine.AuthMode = authMode
+	cfg, err = config.CustomizeConfig(cfg, `{
+		"security": {
+			"groups": [
+				{"name": "test01", "hmackey": "01234567890~!@#$%^&*-_=+ABCabc"},
+				{"name": "limited", "hmackey": "limitedkey", "requestsPerSecond": 1}
+			],
+			"handlerAccess": [{"pattern": "/admin/**", "allowGroups": ["limited"]}]
+		}
+	}`)
+	assert.Nil(tst, err, "No error")
+	return cfg
+}
+
+// echoHandler writes the group and message Middleware put in the context
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	group, _ := GroupFromContext(r.Context())
+	message, _ := MessageFromContext(r.Context())
+	body, _ := ioutil.ReadAll(r.Body)
+	w.Write([]byte(group + "|" + message + "|" + string(body)))
+})
+
+func serve(handler http.Handler, group string, key string, path string, body string) (*httptest.ResponseRecorder, MiddlewareError) {
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	if group != "" {
+		req.Header.Set(HeaderGroup, group)
+	}
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var merr MiddlewareError
+	if rec.Code != http.StatusOK {
+		json.Unmarshal(rec.Body.Bytes(), &merr)
+	}
+	return rec, merr
+}
+
+func TestMiddlewareHMAC(tst *testing.T) {
+	cfg := middlewareTestConfig(tst, "hmac")
+	handler := Middleware(cfg, MiddlewareOptions{})(echoHandler)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	encoded, _ := EncodeHMAC("01234567890~!@#$%^&*-_=+ABCabc", `{"a":1}`, now)
+	rec, _ := serve(handler, "test01", "", "/request/v1/test", string(encoded))
+	assert.Equal(tst, http.StatusOK, rec.Code, "Signed request should pass")
+	assert.Equal(tst, `test01|{"a":1}|`+string(encoded), rec.Body.String(), "Group and message should be in the context, and the body still readable")
+
+	rec, merr := serve(handler, "", "", "/request/v1/test", string(encoded))
+	assert.Equal(tst, http.StatusBadRequest, rec.Code, "Missing group")
+	assert.Equal(tst, http.StatusBadRequest, merr.Status, "Status should be in the json too")
+	assert.Equal(tst, "application/json", rec.Header().Get("Content-Type"), "Errors should be json")
+
+	rec, _ = serve(handler, "test01", "", "/request/v1/test", "not json")
+	assert.Equal(tst, http.StatusBadRequest, rec.Code, "Malformed message")
+
+	wrongKey, _ := EncodeHMAC("wrong key", `{"a":1}`, now)
+	rec, merr = serve(handler, "test01", "", "/request/v1/test", string(wrongKey))
+	assert.Equal(tst, http.StatusUnauthorized, rec.Code, "Bad signature")
+	assert.Equal(tst, ErrBadSignature.Error(), merr.Error, "Error should be the bad signature")
+
+	rec, merr = serve(handler, "nogroup", "", "/request/v1/test", string(encoded))
+	assert.Equal(tst, http.StatusUnauthorized, rec.Code, "Unknown group")
+	assert.Equal(tst, ErrBadSignature.Error(), merr.Error, "Unknown groups look like bad signatures")
+
+	expired, _ := EncodeHMAC("01234567890~!@#$%^&*-_=+ABCabc", `{"a":1}`, strconv.FormatInt(time.Now().Unix()-60, 10))
+	rec, _ = serve(handler, "test01", "", "/request/v1/test", string(expired))
+	assert.Equal(tst, http.StatusUnauthorized, rec.Code, "Expired message")
+
+	// handlerAccess
+	rec, _ = serve(handler, "test01", "", "/admin/users", string(encoded))
+	assert.Equal(tst, http.StatusForbidden, rec.Code, "test01 may not access /admin")
+
+	// Rate limits
+	limited, _ := EncodeHMAC("limitedkey", "hi", now)
+	rec, _ = serve(handler, "limited", "", "/admin/users", string(limited))
+	assert.Equal(tst, http.StatusOK, rec.Code, "First request is within the limit")
+	rec, _ = serve(handler, "limited", "", "/admin/users", string(limited))
+	assert.Equal(tst, http.StatusTooManyRequests, rec.Code, "Second request is over the limit")
+	assert.Equal(tst, "1", rec.Header().Get("Retry-After"), "Retry-After should be in whole seconds")
+}
+
+func TestMiddlewareSimple(tst *testing.T) {
+	cfg := middlewareTestConfig(tst, "simple")
+	handler := Middleware(cfg, MiddlewareOptions{MaxBodyBytes: 16})(echoHandler)
+
+	rec, _ := serve(handler, "test01", "01234567890~!@#$%^&*-_=+ABCabc", "/request/v1/test", `{"a":1}`)
+	assert.Equal(tst, http.StatusOK, rec.Code, "Correct key should pass")
+	assert.Equal(tst, `test01|{"a":1}|{"a":1}`, rec.Body.String(), "The body is the message")
+
+	rec, merr := serve(handler, "test01", "wrong key", "/request/v1/test", `{"a":1}`)
+	assert.Equal(tst, http.StatusUnauthorized, rec.Code, "Wrong key")
+	assert.Equal(tst, "Security error- Invalid group or key", merr.Error, "Error should not say which was wrong")
+
+	rec, _ = serve(handler, "test01", "01234567890~!@#$%^&*-_=+ABCabc", "/request/v1/test", strings.Repeat("x", 17))
+	assert.Equal(tst, http.StatusRequestEntityTooLarge, rec.Code, "Body over MaxBodyBytes")
+}
+
+func TestMiddlewareAuthLimit(tst *testing.T) {
+	cfg := middlewareTestConfig(tst, "simple")
+	handler := Middleware(cfg, MiddlewareOptions{AuthLimit: Limit{Rate: 1, Burst: 2}})(echoHandler)
+
+	// Failed attempts count, so guessing keys is throttled before any key is checked
+	for i := 0; i < 2; i++ {
+		rec, _ := serve(handler, "test01", "wrong key", "/request/v1/test", "")
+		assert.Equal(tst, http.StatusUnauthorized, rec.Code, "Attempt within the limit is checked")
+	}
+	rec, _ := serve(handler, "test01", "01234567890~!@#$%^&*-_=+ABCabc", "/request/v1/test", "")
+	assert.Equal(tst, http.StatusTooManyRequests, rec.Code, "Attempt over the limit isn't checked")
+	assert.Equal(tst, "1", rec.Header().Get("Retry-After"), "Retry-After should be set")
+
+	// Other clients aren't affected
+	req := httptest.NewRequest("POST", "/request/v1/test", nil)
+	req.RemoteAddr = "198.51.100.7:1234"
+	req.Header.Set(HeaderGroup, "test01")
+	req.Header.Set(HeaderKey, "01234567890~!@#$%^&*-_=+ABCabc")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(tst, http.StatusOK, rec.Code, "Another IP has its own limit")
+
+	assert.Panics(tst, func() { Middleware(cfg, MiddlewareOptions{AuthLimit: Limit{Rate: 0, Burst: 5}}) }, "A limit that never refills should fail loudly")
+
+	handler = Middleware(cfg, MiddlewareOptions{AuthLimit: Limit{Rate: -1}})(echoHandler)
+	for i := 0; i < 5; i++ {
+		rec, _ = serve(handler, "test01", "wrong key", "/request/v1/test", "")
+		assert.Equal(tst, http.StatusUnauthorized, rec.Code, "No limit before authentication")
+	}
+}
+
+func TestMiddlewareAuthMode(tst *testing.T) {
+	// The mode comes from engine > authMode, even if the config wasn't normalized by BuildConfig
+	cfg := middlewareTestConfig(tst, "SIMPLE")
+	cfg.Engine.AuthModeValue = config.AuthModeHMAC
+	handler := Middleware(cfg, MiddlewareOptions{})(echoHandler)
+	rec, _ := serve(handler, "test01", "01234567890~!@#$%^&*-_=+ABCabc", "/request/v1/test", "hi")
+	assert.Equal(tst, http.StatusOK, rec.Code, "Simple auth should be used")
+
+	cfg.Engine.AuthMode = "basic"
+	assert.Panics(tst, func() { Middleware(cfg, MiddlewareOptions{}) }, "Unknown authMode should fail loudly")
+}
+
+func TestMiddlewareVerifierOption(tst *testing.T) {
+	cfg := middlewareTestConfig(tst, "hmac")
+	start := time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC)
+	verifier := NewMessageVerifier(cfg)
+	verifier.Clock = NewFakeClock(start)
+	verifier.Nonces = NewMemoryNonceStore(10)
+	handler := Middleware(cfg, MiddlewareOptions{Verifier: verifier})(echoHandler)
+
+	nonce, _ := NewNonce()
+	encoded, _ := EncodeHMACWithNonce("01234567890~!@#$%^&*-_=+ABCabc", "hi", start.Format(time.RFC3339), nonce)
+	rec, _ := serve(handler, "test01", "", "/request/v1/test", string(encoded))
+	assert.Equal(tst, http.StatusOK, rec.Code, "Message is current by the fake clock")
+	rec, merr := serve(handler, "test01", "", "/request/v1/test", string(encoded))
+	assert.Equal(tst, http.StatusUnauthorized, rec.Code, "Replay should be rejected")
+	assert.Equal(tst, ErrReplayed.Error(), merr.Error, "Error should be the replay")
+
+	verifier.Nonces = NewMemoryNonceStore(0)
+	nonce, _ = NewNonce()
+	encoded, _ = EncodeHMACWithNonce("01234567890~!@#$%^&*-_=+ABCabc", "hi", start.Format(time.RFC3339), nonce)
+	rec, _ = serve(handler, "test01", "", "/request/v1/test", string(encoded))
+	assert.Equal(tst, http.StatusServiceUnavailable, rec.Code, "Full nonce store should be unavailable, not an internal error")
+}
+
+func TestMiddlewareMarksLastUse(tst *testing.T) {
+	dir, err := ioutil.TempDir("", "boltmiddleware")
+	assert.Nil(tst, err, "No error")
+	defer os.RemoveAll(dir)
+	store, err := NewFileCredentialStore(filepath.Join(dir, "credentials.json"), config.AuthModeHMAC)
+	assert.Nil(tst, err, "No error")
+	assert.Nil(tst, store.Put(Credential{Group: "web", GroupKey: config.GroupKey{ID: "k1", Key: "01234567890~!@#$%^&*-_=+webkey"}}), "No error")
+
+	cfg := middlewareTestConfig(tst, "hmac")
+	start := time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC)
+	verifier := NewMessageVerifierWithStore(cfg, store)
+	verifier.Clock = NewFakeClock(start)
+	handler := Middleware(cfg, MiddlewareOptions{Credentials: store, Verifier: verifier})(echoHandler)
+
+	encoded, _ := EncodeHMAC("01234567890~!@#$%^&*-_=+webkey", "hi", start.Format(time.RFC3339))
+	rec, _ := serve(handler, "web", "", "/request/v1/test", string(encoded))
+	assert.Equal(tst, http.StatusOK, rec.Code, "Signed message should be accepted")
+
+	creds, err := store.Credentials("web")
+	assert.Nil(tst, err, "No error")
+	if assert.NotNil(tst, creds[0].LastUsed, "Hmac request should record the key's last use") {
+		assert.True(tst, start.Equal(*creds[0].LastUsed), "Last use should come from the verifier's clock")
+	}
+}
@@ -0,0 +1,157 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// NonceStore remembers the nonces of messages already accepted, for replay protection in DecodeHMACWithNonce.
+// Nonces are scoped, by group in MessageVerifier, so one group's nonces never collide with another's.
+type NonceStore interface {
+	// CheckAndStore records nonce in scope for ttl and returns true, or returns false if it's already recorded in scope
+	CheckAndStore(scope string, nonce string, ttl time.Duration) (fresh bool, err error)
+}
+
+// NonceSize is the number of random bytes in a nonce from NewNonce
+const NonceSize = 16
+
+// NewNonce returns a random hex nonce for EncodeHMACWithNonce
+func NewNonce() (string, error) {
+	b := make([]byte, NonceSize)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ErrNonceStoreFull is returned by MemoryNonceStore when a scope holds maxEntries unexpired nonces.
+// Messages are rejected rather than forgetting a nonce early, which would allow it to be replayed.
+var ErrNonceStoreFull = errors.New("Security error- Nonce store is full")
+
+// MemoryNonceStore is a NonceStore for a single engine, safe for concurrent use.
+// Each scope holds at most maxEntries nonces, so a group that fills its own scope doesn't block the others;
+// expired nonces are removed as new ones are added, and always before a nonce is refused.
+type MemoryNonceStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	scopes     map[string]*nonceScope
+	now        func() time.Time
+}
+
+// nonceScope holds the nonces of one scope
+type nonceScope struct {
+	expires map[string]time.Time
+	order   []nonceEntry // insertion order, for sweeping the oldest nonces first
+}
+
+type nonceEntry struct {
+	nonce   string
+	expires time.Time
+}
+
+// NewMemoryNonceStore returns an empty store holding at most maxEntries nonces per scope
+func NewMemoryNonceStore(maxEntries int) *MemoryNonceStore {
+	return &MemoryNonceStore{
+		maxEntries: maxEntries,
+		scopes:     make(map[string]*nonceScope),
+		now:        time.Now,
+	}
+}
+
+// CheckAndStore implements NonceStore
+func (s *MemoryNonceStore) CheckAndStore(scope string, nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	sc, ok := s.scopes[scope]
+	if !ok {
+		sc = &nonceScope{expires: make(map[string]time.Time)}
+		s.scopes[scope] = sc
+	}
+	sc.sweepOldest(now)
+
+	if exp, ok := sc.expires[nonce]; ok && now.Before(exp) {
+		return false, nil
+	}
+
+	if len(sc.expires) >= s.maxEntries {
+		// Nonces can have different ttls, so the oldest may outlive newer ones; check them all before giving up
+		sc.sweepAll(now)
+		if len(sc.expires) >= s.maxEntries {
+			return false, ErrNonceStoreFull
+		}
+	}
+
+	exp := now.Add(ttl)
+	sc.expires[nonce] = exp
+	sc.order = append(sc.order, nonceEntry{nonce: nonce, expires: exp})
+	return true, nil
+}
+
+// Len returns the number of nonces held in every scope, including any expired ones not yet removed
+func (s *MemoryNonceStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, sc := range s.scopes {
+		n += len(sc.expires)
+	}
+	return n
+}
+
+// sweepOldest removes expired nonces from the front of the insertion order
+func (sc *nonceScope) sweepOldest(now time.Time) {
+	i := 0
+	for ; i < len(sc.order) && !now.Before(sc.order[i].expires); i++ {
+		sc.remove(sc.order[i])
+	}
+	if i > 0 {
+		sc.order = append(sc.order[:0], sc.order[i:]...)
+	}
+}
+
+// sweepAll removes every expired nonce
+func (sc *nonceScope) sweepAll(now time.Time) {
+	kept := sc.order[:0]
+	for _, e := range sc.order {
+		if now.Before(e.expires) {
+			kept = append(kept, e)
+		} else {
+			sc.remove(e)
+		}
+	}
+	sc.order = kept
+}
+
+// remove deletes e from the map, unless the nonce was stored again after it expired
+func (sc *nonceScope) remove(e nonceEntry) {
+	if exp, ok := sc.expires[e.nonce]; ok && exp.Equal(e.expires) {
+		delete(sc.expires, e.nonce)
+	}
+}
+
+// RedisSetNX is the one redis command RedisNonceStore needs: SET key value NX PX ttl, returning whether the key was set.
+// Wrap whichever redis client the engine uses, ex: for go-redis
+//
+//	func(key string, ttl time.Duration) (bool, error) { return client.SetNX(key, 1, ttl).Result() }
+type RedisSetNX func(key string, ttl time.Duration) (bool, error)
+
+// RedisNonceStore is a NonceStore shared by every engine using the same redis (or redis-compatible) cache
+type RedisNonceStore struct {
+	SetNX  RedisSetNX
+	Prefix string // prepended to each scope:nonce to form the key, ex: cfg.Cache.KeyPrefix + "nonce:"
+}
+
+// CheckAndStore implements NonceStore
+func (s *RedisNonceStore) CheckAndStore(scope string, nonce string, ttl time.Duration) (bool, error) {
+	return s.SetNX(s.Prefix+scope+":"+nonce, ttl)
+}
@@ -0,0 +1,129 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryNonceStore(tst *testing.T) {
+	now := time.Now()
+	s := NewMemoryNonceStore(2)
+	s.now = func() time.Time { return now }
+
+	fresh, err := s.CheckAndStore("test01", "a", time.Minute)
+	assert.Nil(tst, err, "No error")
+	assert.True(tst, fresh, "First use is fresh")
+	fresh, _ = s.CheckAndStore("test01", "a", time.Minute)
+	assert.False(tst, fresh, "Second use is a replay")
+
+	s.CheckAndStore("test01", "b", 2*time.Minute)
+	_, err = s.CheckAndStore("test01", "c", time.Minute)
+	assert.Equal(tst, ErrNonceStoreFull, err, "Full store should refuse new nonces")
+
+	now = now.Add(61 * time.Second)
+	fresh, err = s.CheckAndStore("test01", "c", time.Minute)
+	assert.Nil(tst, err, "Expired nonces make room")
+	assert.True(tst, fresh, "c is fresh")
+	assert.Equal(tst, 2, s.Len(), "a was swept")
+	fresh, _ = s.CheckAndStore("test01", "a", time.Minute)
+	assert.False(tst, fresh, "Store is full again, so a is refused")
+
+	now = now.Add(2 * time.Minute)
+	fresh, _ = s.CheckAndStore("test01", "a", time.Minute)
+	assert.True(tst, fresh, "An expired nonce can be used again")
+	assert.Equal(tst, 1, s.Len(), "b and c were swept")
+
+	// Scopes are separate, and a full scope doesn't block the others
+	s.CheckAndStore("test01", "b", time.Minute)
+	_, err = s.CheckAndStore("test01", "c", time.Minute)
+	assert.Equal(tst, ErrNonceStoreFull, err, "test01 is full")
+	fresh, err = s.CheckAndStore("test02", "a", time.Minute)
+	assert.Nil(tst, err, "test02 isn't full")
+	assert.True(tst, fresh, "A nonce used in another scope is fresh")
+	assert.Equal(tst, 3, s.Len(), "Len counts every scope")
+}
+
+func TestMemoryNonceStoreConcurrent(tst *testing.T) {
+	s := NewMemoryNonceStore(1000)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				if fresh, _ := s.CheckAndStore("test01", strconv.Itoa(n), time.Minute); fresh {
+					mu.Lock()
+					accepted++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(tst, 100, accepted, "Each nonce should be accepted exactly once")
+}
+
+func TestRedisNonceStore(tst *testing.T) {
+	keys := make(map[string]bool)
+	s := &RedisNonceStore{
+		Prefix: "bolt:nonce:",
+		SetNX: func(key string, ttl time.Duration) (bool, error) {
+			if keys[key] {
+				return false, nil
+			}
+			keys[key] = true
+			return true, nil
+		},
+	}
+	fresh, _ := s.CheckAndStore("test01", "a", time.Minute)
+	assert.True(tst, fresh, "First use is fresh")
+	fresh, _ = s.CheckAndStore("test01", "a", time.Minute)
+	assert.False(tst, fresh, "Second use is a replay")
+	assert.True(tst, keys["bolt:nonce:test01:a"], "Key should be prefixed and scoped")
+	fresh, _ = s.CheckAndStore("test02", "a", time.Minute)
+	assert.True(tst, fresh, "Another scope's nonce is fresh")
+}
+
+func TestDecodeHMACWithNonce(tst *testing.T) {
+	key := "01234567890~!@#$%^&*-_=+ABCabc"
+	store := NewMemoryNonceStore(100)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	nonce, err := NewNonce()
+	assert.Nil(tst, err, "No error")
+	assert.Len(tst, nonce, 2*NonceSize, "Nonce should be hex")
+
+	encoded, err := EncodeHMACWithNonce(key, "hello", now, nonce)
+	assert.Nil(tst, err, "No error")
+
+	decoded, err := DecodeHMACWithNonce(key, encoded, 30, store)
+	assert.Nil(tst, err, "First decode should succeed")
+	assert.Equal(tst, "hello", decoded, "Message should decode")
+
+	decoded, err = DecodeHMACWithNonce(key, encoded, 30, store)
+	assert.NotNil(tst, err, "Replay should fail")
+	assert.Equal(tst, "Error verifying nonce", decoded, "Replay should report the nonce")
+
+	// Plain DecodeHMAC still accepts it, and messages without a nonce aren't accepted by the nonce variant
+	decoded, err = DecodeHMAC(key, encoded, 30)
+	assert.Nil(tst, err, "DecodeHMAC ignores the nonce")
+	assert.Equal(tst, "hello", decoded, "Message should decode")
+	encoded, _ = EncodeHMAC(key, "hello", now)
+	_, err = DecodeHMACWithNonce(key, encoded, 30, store)
+	assert.NotNil(tst, err, "Missing nonce should fail")
+
+	// The same nonce signed with another key is its own
+	encoded, _ = EncodeHMACWithNonce("another key entirely, just as long", "hello", now, nonce)
+	_, err = DecodeHMACWithNonce("another key entirely, just as long", encoded, 30, store)
+	assert.Nil(tst, err, "Nonces are scoped to the key")
+}
@@ -0,0 +1,224 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+)
+
+// Limit is the token bucket for one group: Rate tokens are added per second, up to Burst
+type Limit struct {
+	Rate  float64
+	Burst int64
+}
+
+// ErrInvalidRateLimit is returned by MemoryRateLimitStore.Take for a Limit without a positive Rate, whose bucket would never refill
+var ErrInvalidRateLimit = errors.New("Security error- Rate limit needs a positive rate")
+
+// RateLimitStore holds the token buckets for a RateLimiter.  MemoryRateLimitStore keeps them in this process;
+// implement it over a shared cache to limit a group across every engine.
+type RateLimitStore interface {
+	// Take removes a token from the bucket for key, created full if it doesn't exist.
+	// If reserve is false and no token is available, nothing is taken, ok is false and wait is how long until one is.
+	// If reserve is true the token is always taken, letting the bucket go into debt, and wait is how long the caller
+	// must wait before using it.  limit.Rate must be positive.
+	Take(key string, limit Limit, reserve bool) (ok bool, wait time.Duration, err error)
+}
+
+// RateLimiter limits each security group to its requestsPerSecond, allowing bursts of up to burst requests.
+// Groups with rateLimitPerIP get a bucket per client IP.  Groups without a requestsPerSecond, and unknown groups,
+// aren't limited.  Call Update when the config is reloaded; buckets keep their tokens and move to the new limits.
+type RateLimiter struct {
+	store  RateLimitStore
+	groups atomic.Value // map[string]config.SecurityGroups
+}
+
+// NewRateLimiter returns a RateLimiter for the groups in cfg, keeping buckets in store, or in a new MemoryRateLimitStore if store is nil
+func NewRateLimiter(cfg *config.Config, store RateLimitStore) *RateLimiter {
+	if store == nil {
+		store = NewMemoryRateLimitStore()
+	}
+	l := &RateLimiter{store: store}
+	l.Update(cfg)
+	return l
+}
+
+// Update replaces the limits with those in cfg
+func (l *RateLimiter) Update(cfg *config.Config) {
+	groups := make(map[string]config.SecurityGroups)
+	for _, g := range cfg.Security.Groups {
+		groups[g.Name] = g
+	}
+	l.groups.Store(groups)
+}
+
+// Allow takes a token for group (and clientIP, if the group is limited per IP) if one is available.
+// If not, allowed is false and retryAfter is how long until one is, ex: for a Retry-After header.
+// If the store fails the request is allowed, so a cache outage doesn't take the api down with it.
+func (l *RateLimiter) Allow(group string, clientIP string) (allowed bool, retryAfter time.Duration) {
+	key, limit, ok := l.bucket(group, clientIP)
+	if !ok {
+		return true, 0
+	}
+	allowed, retryAfter, err := l.store.Take(key, limit, false)
+	if err != nil {
+		return true, 0
+	}
+	return allowed, retryAfter
+}
+
+// Reserve always takes a token for group (and clientIP), and returns how long the caller must wait before acting on it,
+// ex: to queue work rather than reject it.  Like Allow, it doesn't wait if the store fails.
+func (l *RateLimiter) Reserve(group string, clientIP string) (delay time.Duration) {
+	key, limit, ok := l.bucket(group, clientIP)
+	if !ok {
+		return 0
+	}
+	_, delay, err := l.store.Take(key, limit, true)
+	if err != nil {
+		return 0
+	}
+	return delay
+}
+
+// authLimitKey starts the bucket keys of Middleware's per IP limit, and can't start a group's key
+const authLimitKey = "\x00auth|"
+
+// allowKey is Allow for a bucket that isn't a group's, ex: Middleware's limit before authentication
+func (l *RateLimiter) allowKey(key string, limit Limit) (allowed bool, retryAfter time.Duration) {
+	allowed, retryAfter, err := l.store.Take(key, limit, false)
+	if err != nil {
+		return true, 0
+	}
+	return allowed, retryAfter
+}
+
+// bucket returns the bucket key and limit for a request, or ok false if it isn't limited
+func (l *RateLimiter) bucket(group string, clientIP string) (key string, limit Limit, ok bool) {
+	g, found := l.groups.Load().(map[string]config.SecurityGroups)[group]
+	if !found || g.RequestsPerSecond <= 0 {
+		return "", Limit{}, false
+	}
+	limit = Limit{Rate: float64(g.RequestsPerSecond), Burst: g.Burst}
+	if limit.Burst <= 0 {
+		limit.Burst = g.RequestsPerSecond
+	}
+	key = group
+	if g.RateLimitPerIP {
+		key = group + "|" + clientIP
+	}
+	return key, limit, true
+}
+
+// rateLimitShards spreads buckets over separate locks so busy groups and IPs don't contend
+const rateLimitShards = 64
+
+// sweepEvery is how many takes a shard handles between removing idle buckets
+const sweepEvery = 1024
+
+// MemoryRateLimitStore is a RateLimitStore for a single engine, safe for heavy concurrent use.
+// Buckets that have been idle long enough to refill are removed, since a full bucket is the same as a new one.
+type MemoryRateLimitStore struct {
+	shards [rateLimitShards]rateLimitShard
+	now    func() time.Time
+}
+
+type rateLimitShard struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	takes   int
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// NewMemoryRateLimitStore returns an empty store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	s := &MemoryRateLimitStore{now: time.Now}
+	for i := range s.shards {
+		s.shards[i].buckets = make(map[string]*tokenBucket)
+	}
+	return s
+}
+
+// Take implements RateLimitStore
+func (s *MemoryRateLimitStore) Take(key string, limit Limit, reserve bool) (bool, time.Duration, error) {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	shard := &s.shards[h.Sum32()%rateLimitShards]
+
+	if limit.Rate <= 0 {
+		return false, 0, ErrInvalidRateLimit
+	}
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	now := s.now()
+	shard.takes++
+	if shard.takes%sweepEvery == 0 {
+		shard.sweep(now)
+	}
+
+	b, found := shard.buckets[key]
+	if !found {
+		b = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		shard.buckets[key] = b
+	}
+	b.limit = limit
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	if !reserve {
+		return false, wait, nil
+	}
+	b.tokens--
+	return true, wait, nil
+}
+
+// Len returns the number of buckets held
+func (s *MemoryRateLimitStore) Len() int {
+	n := 0
+	for i := range s.shards {
+		s.shards[i].mu.Lock()
+		n += len(s.shards[i].buckets)
+		s.shards[i].mu.Unlock()
+	}
+	return n
+}
+
+// refill adds the tokens earned since the bucket was last used, up to its burst
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.limit.Rate
+		b.last = now
+	}
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+}
+
+// sweep removes buckets that would be full by now
+func (shard *rateLimitShard) sweep(now time.Time) {
+	for key, b := range shard.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(shard.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func rateLimitTestConfig(tst *testing.T, groups string) *config.Config {
+	cfg, err := config.DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	cfg, err = config.CustomizeConfig(cfg, `{"security": {"groups": `+groups+`}}`)
+	assert.Nil(tst, err, "No error")
+	return cfg
+}
+
+func TestRateLimiter(tst *testing.T) {
+	cfg := rateLimitTestConfig(tst, `[
+		{"name": "limited", "requestsPerSecond": 2, "burst": 3},
+		{"name": "perip", "requestsPerSecond": 1, "rateLimitPerIP": true},
+		{"name": "unlimited"}
+	]`)
+	now := time.Now()
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	l := NewRateLimiter(cfg, store)
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := l.Allow("limited", "1.1.1.1")
+		assert.True(tst, allowed, "Burst should be allowed")
+	}
+	allowed, retryAfter := l.Allow("limited", "2.2.2.2")
+	assert.False(tst, allowed, "Bucket should be empty after the burst, whatever the IP")
+	assert.Equal(tst, 500*time.Millisecond, retryAfter, "A token is added every half second")
+
+	now = now.Add(500 * time.Millisecond)
+	allowed, _ = l.Allow("limited", "1.1.1.1")
+	assert.True(tst, allowed, "A token should have been added")
+
+	// Reserve goes into debt
+	assert.Equal(tst, 500*time.Millisecond, l.Reserve("limited", ""), "First reservation waits for the next token")
+	assert.Equal(tst, time.Second, l.Reserve("limited", ""), "Second reservation waits for the one after")
+
+	allowed, _ = l.Allow("perip", "1.1.1.1")
+	assert.True(tst, allowed, "First IP allowed")
+	allowed, _ = l.Allow("perip", "1.1.1.1")
+	assert.False(tst, allowed, "First IP limited")
+	allowed, _ = l.Allow("perip", "2.2.2.2")
+	assert.True(tst, allowed, "Second IP has its own bucket")
+
+	for i := 0; i < 100; i++ {
+		allowed, _ = l.Allow("unlimited", "1.1.1.1")
+		assert.True(tst, allowed, "Groups without requestsPerSecond aren't limited")
+	}
+	allowed, _ = l.Allow("nogroup", "1.1.1.1")
+	assert.True(tst, allowed, "Unknown groups aren't limited")
+
+	// Reload with a higher limit
+	l.Update(rateLimitTestConfig(tst, `[{"name": "perip", "requestsPerSecond": 10, "rateLimitPerIP": true}]`))
+	now = now.Add(100 * time.Millisecond)
+	allowed, _ = l.Allow("perip", "1.1.1.1")
+	assert.True(tst, allowed, "New rate applies after a reload")
+	allowed, _ = l.Allow("limited", "1.1.1.1")
+	assert.True(tst, allowed, "Groups removed by a reload aren't limited")
+}
+
+func TestMemoryRateLimitStoreSweep(tst *testing.T) {
+	now := time.Now()
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	for i := 0; i < 2*sweepEvery*rateLimitShards; i++ {
+		store.Take(strconv.Itoa(i), Limit{Rate: 1, Burst: 1}, false)
+		now = now.Add(time.Millisecond)
+	}
+	assert.True(tst, store.Len() < 2*sweepEvery*rateLimitShards, "Idle buckets should be swept")
+}
+
+func TestMemoryRateLimitStoreConcurrent(tst *testing.T) {
+	store := NewMemoryRateLimitStore()
+	var allowed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				if ok, _, _ := store.Take("group", Limit{Rate: 0.001, Burst: 50}, false); ok {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(tst, int64(50), allowed, "Exactly the burst should be allowed")
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(key string, limit Limit, reserve bool) (bool, time.Duration, error) {
+	return false, 0, errors.New("cache down")
+}
+
+func TestRateLimiterStoreError(tst *testing.T) {
+	l := NewRateLimiter(rateLimitTestConfig(tst, `[{"name": "limited", "requestsPerSecond": 1}]`), failingStore{})
+	allowed, _ := l.Allow("limited", "")
+	assert.True(tst, allowed, "Requests are allowed when the store fails")
+}
+
+func TestMemoryRateLimitStoreZeroRate(tst *testing.T) {
+	s := NewMemoryRateLimitStore()
+	ok, wait, err := s.Take("key", Limit{Rate: 0, Burst: 5}, false)
+	assert.True(tst, errors.Is(err, ErrInvalidRateLimit), "A zero rate should be rejected")
+	assert.False(tst, ok, "No token is taken")
+	assert.Equal(tst, time.Duration(0), wait, "No wait is computed")
+}
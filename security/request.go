@@ -0,0 +1,308 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/TeamFairmont/boltshared/utils"
+)
+
+// RequestSigningAlgorithm starts the Authorization header of a request signed by SignRequest
+const RequestSigningAlgorithm = "BOLT-HMAC-SHA512"
+
+// Request components covered by the signature, in canonical order
+const (
+	ComponentMethod  = "method"
+	ComponentPath    = "path"
+	ComponentQuery   = "query"
+	ComponentHeaders = "headers"
+	ComponentBody    = "body"
+)
+
+var requestComponents = []string{ComponentMethod, ComponentPath, ComponentQuery, ComponentHeaders, ComponentBody}
+
+// MaxRequestBodyBytes is the largest body VerifyRequest reads before rejecting the request as malformed
+var MaxRequestBodyBytes int64 = DefaultMaxBodyBytes
+
+// digestLength is the number of hex characters of each component digest sent with the signature.
+// They only let VerifyRequest report which component differs; the signature itself covers the full values.
+const digestLength = 16
+
+// CanonicalRequest is the normalized form of an http request that SignRequest signs and VerifyRequest checks
+type CanonicalRequest struct {
+	Method        string // upper case
+	Path          string // escaped, "/" if blank
+	Query         string // sorted by name then value, RFC 3986 escaped
+	Headers       string // lower case name:trimmed value lines, sorted by name
+	SignedHeaders string // lower case names joined with ";", always including host
+	BodyHash      string // hex SHA-512 of the body
+}
+
+// RequestSignatureError is returned by VerifyRequest when the signature doesn't match.  It matches ErrBadSignature.
+// Components lists the parts of the request that differ from what the client signed; if it's empty
+// the request matched and the signature or key is wrong.
+type RequestSignatureError struct {
+	Components []string
+}
+
+func (e *RequestSignatureError) Error() string {
+	if len(e.Components) == 0 {
+		return "Security error- Invalid request signature"
+	}
+	return "Security error- Invalid request signature (mismatched " + strings.Join(e.Components, ", ") + ")"
+}
+
+// Is lets errors.Is(err, ErrBadSignature) match
+func (e *RequestSignatureError) Is(target error) bool {
+	return target == ErrBadSignature
+}
+
+// NewCanonicalRequest builds the canonical form of a request.  signedHeaders names the headers to cover
+// in addition to host, which is always signed.  host is the request's Host, ex: req.Host.
+func NewCanonicalRequest(method string, u *url.URL, host string, header http.Header, signedHeaders []string, body []byte) CanonicalRequest {
+	c := CanonicalRequest{Method: strings.ToUpper(method)}
+
+	c.Path = u.EscapedPath()
+	if c.Path == "" {
+		c.Path = "/"
+	}
+
+	values, _ := url.ParseQuery(u.RawQuery)
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var query []string
+	for _, name := range names {
+		vals := append([]string(nil), values[name]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			query = append(query, escapeQuery(name)+"="+escapeQuery(v))
+		}
+	}
+	c.Query = strings.Join(query, "&")
+
+	headerNames := []string{"host"}
+	for _, name := range signedHeaders {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !utils.StringInSlice(name, headerNames) {
+			headerNames = append(headerNames, name)
+		}
+	}
+	sort.Strings(headerNames)
+	var lines []string
+	for _, name := range headerNames {
+		var value string
+		if name == "host" {
+			value = strings.ToLower(host)
+		} else {
+			vals := header[http.CanonicalHeaderKey(name)]
+			trimmed := make([]string, len(vals))
+			for i, v := range vals {
+				trimmed[i] = strings.Join(strings.Fields(v), " ")
+			}
+			value = strings.Join(trimmed, ",")
+		}
+		lines = append(lines, name+":"+value)
+	}
+	c.Headers = strings.Join(lines, "\n")
+	c.SignedHeaders = strings.Join(headerNames, ";")
+
+	sum := sha512.Sum512(body)
+	c.BodyHash = hex.EncodeToString(sum[:])
+	return c
+}
+
+// String returns the canonical request, one component per line
+func (c CanonicalRequest) String() string {
+	return strings.Join([]string{c.Method, c.Path, c.Query, c.Headers, c.SignedHeaders, c.BodyHash}, "\n")
+}
+
+// stringToSign ties the canonical request to the group and timestamp
+func (c CanonicalRequest) stringToSign(group string, timestamp string) []byte {
+	return []byte(RequestSigningAlgorithm + "\n" + timestamp + "\n" + group + "\n" + c.String())
+}
+
+// digests returns a short hash of each component, in requestComponents order
+func (c CanonicalRequest) digests() []string {
+	parts := []string{c.Method, c.Path, c.Query, c.Headers + "\n" + c.SignedHeaders, c.BodyHash}
+	digests := make([]string, len(parts))
+	for i, part := range parts {
+		sum := sha512.Sum512([]byte(part))
+		digests[i] = hex.EncodeToString(sum[:])[:digestLength]
+	}
+	return digests
+}
+
+// SignRequest signs req with the group's hmac key and sets its Authorization header, ex:
+//
+//	Authorization: BOLT-HMAC-SHA512 Group=test01, Timestamp=1500000000, SignedHeaders=content-type;host, Digests=..., Signature=...
+//
+// The signature covers the method, path, sorted query, host plus signedHeaders, and a SHA-512 hash of the body.
+// timestamp is the current unix time in seconds; VerifyRequest rejects it outside of verifyTimeout.
+// The body is read and replaced so req can still be sent.
+func SignRequest(req *http.Request, group string, key string, signedHeaders []string, timestamp string) error {
+	return SignRequestWithKey(req, group, config.GroupKey{Key: key, Algorithm: config.AlgHS512}, signedHeaders, timestamp)
+}
+
+// SignRequestWithKey is SignRequest for one of the group's keys, ex: from config.SecurityGroups.SigningKey.
+// The signature uses the key's algorithm, HS256 or HS512, and the key's ID is sent as KeyID so VerifyRequest tries it first.
+func SignRequestWithKey(req *http.Request, group string, key config.GroupKey, signedHeaders []string, timestamp string) error {
+	if !isHMACKey(key) {
+		return errors.New("Security error- Requests can only be signed with an HS256 or HS512 key")
+	}
+	body, err := readBody(req, 0)
+	if err != nil {
+		return err
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	c := NewCanonicalRequest(req.Method, req.URL, host, req.Header, signedHeaders, body)
+	signature, _ := newHMACSigner(key.Algorithm, key.Key).Sign(c.stringToSign(group, timestamp))
+
+	keyID := ""
+	if key.ID != "" {
+		keyID = ", KeyID=" + key.ID
+	}
+	req.Header.Set("Authorization", RequestSigningAlgorithm+
+		" Group="+group+
+		keyID+
+		", Timestamp="+timestamp+
+		", SignedHeaders="+c.SignedHeaders+
+		", Digests="+strings.Join(c.digests(), ".")+
+		", Signature="+hex.EncodeToString(signature))
+	return nil
+}
+
+// VerifyRequest checks the Authorization header set by SignRequest against req, using the group's keys from groups.
+// Every HS256 or HS512 key that may verify (see config.SecurityGroups.VerifyKeys) is tried, the one named by KeyID first,
+// each with its own algorithm.  Groups without such a key, ex: EdDSA groups, are rejected with ErrNoCredential.
+// It returns the group name if the signature is valid and the timestamp is within +-verifyTimeout seconds.
+// A signature that doesn't match returns a *RequestSignatureError naming the components that differ.
+// The body is read and replaced so the handler can still use it; bodies over MaxRequestBodyBytes are rejected as malformed.
+func VerifyRequest(req *http.Request, groups *[]config.SecurityGroups, verifyTimeout int64) (group string, err error) {
+	params, err := parseRequestAuthorization(req.Header.Get("Authorization"))
+	if err != nil {
+		return "", err
+	}
+	group = params["Group"]
+
+	keys, err := GroupKeys(groups)(group, SystemClock.Now())
+	if err != nil {
+		return "", err
+	}
+	var hmacKeys []config.GroupKey
+	for _, k := range keys {
+		if isHMACKey(k) {
+			hmacKeys = append(hmacKeys, k)
+		}
+	}
+	if len(hmacKeys) == 0 {
+		return "", ErrNoCredential
+	}
+	sort.SliceStable(hmacKeys, func(i, j int) bool {
+		return hmacKeys[i].ID == params["KeyID"] && hmacKeys[j].ID != params["KeyID"]
+	})
+
+	body, err := readBody(req, MaxRequestBodyBytes)
+	if err != nil {
+		return "", err
+	}
+
+	c := NewCanonicalRequest(req.Method, req.URL, req.Host, req.Header, strings.Split(params["SignedHeaders"], ";"), body)
+	signature, err := hex.DecodeString(params["Signature"])
+	verified := false
+	if err == nil {
+		stringToSign := c.stringToSign(group, params["Timestamp"])
+		for _, k := range hmacKeys {
+			if newHMACSigner(k.Algorithm, k.Key).Verify(stringToSign, signature) {
+				verified = true
+				break
+			}
+		}
+	}
+	if !verified {
+		return "", &RequestSignatureError{Components: mismatchedComponents(c.digests(), strings.Split(params["Digests"], "."))}
+	}
+
+	if err := checkTimestamp(SystemClock, params["Timestamp"], verifyTimeout); err != nil {
+		return "", err
+	}
+	return group, nil
+}
+
+// mismatchedComponents compares our component digests with the ones the client sent
+func mismatchedComponents(ours []string, theirs []string) []string {
+	var mismatched []string
+	for i, name := range requestComponents {
+		if i >= len(theirs) || ours[i] != theirs[i] {
+			mismatched = append(mismatched, name)
+		}
+	}
+	return mismatched
+}
+
+// parseRequestAuthorization splits the Authorization header into its Name=value parameters
+func parseRequestAuthorization(header string) (map[string]string, error) {
+	if !strings.HasPrefix(header, RequestSigningAlgorithm+" ") {
+		return nil, malformed("missing "+RequestSigningAlgorithm+" authorization", nil)
+	}
+	params := make(map[string]string)
+	for _, param := range strings.Split(strings.TrimPrefix(header, RequestSigningAlgorithm+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = kv[1]
+		}
+	}
+	for _, name := range []string{"Group", "Timestamp", "SignedHeaders", "Signature"} {
+		if params[name] == "" {
+			return nil, malformed("authorization is missing "+name, nil)
+		}
+	}
+	return params, nil
+}
+
+// readBody returns the request body and replaces it with a fresh reader over the same bytes.
+// Bodies longer than maxBytes return a MalformedError without being read further, unless maxBytes is 0 or less.
+func readBody(req *http.Request, maxBytes int64) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	var reader io.Reader = req.Body
+	if maxBytes > 0 {
+		reader = io.LimitReader(req.Body, maxBytes+1)
+	}
+	body, err := ioutil.ReadAll(reader)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if maxBytes > 0 && int64(len(body)) > maxBytes {
+		return nil, malformed("request body is larger than "+strconv.FormatInt(maxBytes, 10)+" bytes", nil)
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// escapeQuery escapes s per RFC 3986, so spaces become %20 rather than +
+func escapeQuery(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
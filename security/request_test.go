@@ -0,0 +1,126 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalRequest(tst *testing.T) {
+	u, _ := url.Parse("https://bolt.example.com/request/v1/test?b=2&a=hello+world&b=1")
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("X-Extra", "  spaced    out  ")
+
+	c := NewCanonicalRequest("post", u, "Bolt.Example.com", header, []string{"X-Extra", "content-type"}, []byte("{}"))
+	assert.Equal(tst, "POST", c.Method, "Method should be upper case")
+	assert.Equal(tst, "/request/v1/test", c.Path, "Path should be kept")
+	assert.Equal(tst, "a=hello%20world&b=1&b=2", c.Query, "Query should be sorted and escaped")
+	assert.Equal(tst, "content-type:application/json\nhost:bolt.example.com\nx-extra:spaced out", c.Headers, "Headers should be normalized and sorted")
+	assert.Equal(tst, "content-type;host;x-extra", c.SignedHeaders, "Host should always be signed")
+	assert.Len(tst, c.BodyHash, 128, "Body hash should be hex SHA-512")
+}
+
+func TestSignVerifyRequest(tst *testing.T) {
+	groups := []config.SecurityGroups{{Name: "test01", Hmackey: "01234567890~!@#$%^&*-_=+ABCabc"}}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	newRequest := func() *http.Request {
+		req, _ := http.NewRequest("POST", "http://localhost:8888/request/v1/test?x=1", strings.NewReader(`{"a":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		err := SignRequest(req, "test01", "01234567890~!@#$%^&*-_=+ABCabc", []string{"Content-Type"}, now)
+		assert.Nil(tst, err, "No error signing")
+		return req
+	}
+
+	req := newRequest()
+	group, err := VerifyRequest(req, &groups, 30)
+	assert.Nil(tst, err, "Signed request should verify")
+	assert.Equal(tst, "test01", group, "Group should be returned")
+	body, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(tst, `{"a":1}`, string(body), "Body should still be readable after verifying")
+
+	// Replayed against a different api call
+	req = newRequest()
+	req.URL.Path = "/request/v1/other"
+	_, err = VerifyRequest(req, &groups, 30)
+	assert.Equal(tst, []string{ComponentPath}, err.(*RequestSignatureError).Components, "Path should be reported")
+
+	req = newRequest()
+	req.Method = "PUT"
+	req.URL.RawQuery = "x=2"
+	_, err = VerifyRequest(req, &groups, 30)
+	assert.Equal(tst, []string{ComponentMethod, ComponentQuery}, err.(*RequestSignatureError).Components, "Method and query should be reported")
+
+	req = newRequest()
+	req.Header.Set("Content-Type", "text/plain")
+	req.Body = ioutil.NopCloser(strings.NewReader(`{"a":2}`))
+	_, err = VerifyRequest(req, &groups, 30)
+	assert.Equal(tst, []string{ComponentHeaders, ComponentBody}, err.(*RequestSignatureError).Components, "Headers and body should be reported")
+
+	// Same request, wrong key
+	wrongKey := []config.SecurityGroups{{Name: "test01", Hmackey: "not the key"}}
+	_, err = VerifyRequest(newRequest(), &wrongKey, 30)
+	assert.Equal(tst, "Security error- Invalid request signature", err.Error(), "No components differ with the wrong key")
+
+	// Rotated keys, tried from KeyID first, each with its own algorithm
+	rotating := []config.SecurityGroups{{Name: "test01", Keys: []config.GroupKey{
+		{ID: "old", Key: "01234567890~!@#$%^&*-_=+oldkey", Status: config.KeyStatusVerifyOnly},
+		{ID: "new", Key: "01234567890~!@#$%^&*-_=+newkey", Algorithm: config.AlgHS256},
+		{ID: "gone", Key: "01234567890~!@#$%^&*-_=+gonekey", Status: config.KeyStatusRevoked},
+	}}}
+	for _, k := range rotating[0].Keys {
+		req, _ = http.NewRequest("GET", "http://localhost:8888/request/v1/test", nil)
+		assert.Nil(tst, SignRequestWithKey(req, "test01", k, nil, now), "No error signing")
+		_, err = VerifyRequest(req, &rotating, 30)
+		if k.Status == config.KeyStatusRevoked {
+			assert.NotNil(tst, err, "Revoked key should not verify")
+		} else {
+			assert.Nil(tst, err, "Key "+k.ID+" should verify")
+		}
+	}
+
+	// The public key of an EdDSA group is not an hmac secret
+	pub, _, _ := GenerateEd25519Key()
+	eddsa := []config.SecurityGroups{{Name: "test01", Hmackey: pub, Algorithm: config.AlgEdDSA}}
+	req, _ = http.NewRequest("GET", "http://localhost:8888/request/v1/test", nil)
+	SignRequest(req, "test01", pub, nil, now)
+	_, err = VerifyRequest(req, &eddsa, 30)
+	assert.True(tst, errors.Is(err, ErrNoCredential), "Request signed with the public key should be rejected")
+
+	// Expired
+	req, _ = http.NewRequest("GET", "http://localhost:8888/request/v1/test", nil)
+	SignRequest(req, "test01", "01234567890~!@#$%^&*-_=+ABCabc", nil, strconv.FormatInt(time.Now().Unix()-60, 10))
+	_, err = VerifyRequest(req, &groups, 30)
+	assert.NotNil(tst, err, "Expired request should fail")
+
+	// Bodies over MaxRequestBodyBytes are rejected before the signature is checked
+	defer func(max int64) { MaxRequestBodyBytes = max }(MaxRequestBodyBytes)
+	MaxRequestBodyBytes = 4
+	req = newRequest()
+	_, err = VerifyRequest(req, &groups, 30)
+	assert.True(tst, errors.Is(err, ErrMalformedEnvelope), "Body over the limit should be malformed")
+	MaxRequestBodyBytes = 7
+	_, err = VerifyRequest(newRequest(), &groups, 30)
+	assert.Nil(tst, err, "Body at the limit should verify")
+
+	// Unsigned or unknown group
+	req, _ = http.NewRequest("GET", "http://localhost:8888/request/v1/test", nil)
+	_, err = VerifyRequest(req, &groups, 30)
+	assert.NotNil(tst, err, "Unsigned request should fail")
+	SignRequest(req, "nogroup", "key", nil, now)
+	_, err = VerifyRequest(req, &groups, 30)
+	assert.NotNil(tst, err, "Unknown group should fail")
+}
@@ -6,86 +6,56 @@
 package security
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/sha512"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"strconv"
+	"fmt"
+	"sort"
 	"time"
 
 	config "github.com/TeamFairmont/boltshared/config"
 )
 
 // GetKeyFromGroup takes a group name and a pointer to array of groups.
-// It returns the matching hmac key
+// It returns the group's signing key: its newest active key, or its hmackey if it has no keys.
+// Groups without a key that can sign return ErrNoCredential.  See GetKeyFromStore.
 func GetKeyFromGroup(group string, groups *[]config.SecurityGroups) (key string, err error) {
-	for _, thisGroup := range *groups {
-		if thisGroup.Name == group {
-			return thisGroup.Hmackey, nil
-		}
-	}
-	// Group name not found.  The group name to find doesn't exist in the array of groups.  Return an error.
-	return "Error", errors.New("Security error- Invalid group name")
+	return GetKeyFromStore(NewConfigCredentialStore(groups), group)
 }
 
 // signString receives a string to sign and the key to sign with.
 // It returns []byte representing the hmac signed string.
 func signString(stringToSign []byte, sharedSecretKey []byte) []byte {
-	h := hmac.New(sha512.New, sharedSecretKey)
-	h.Write(stringToSign)
-	return h.Sum(nil)
-}
-
-// checkMAC reports whether messageMAC is a valid HMAC tag for message.
-// Use hmac.Equal to compare MACs in order to avoid timing side-channels
-func checkMAC(message, messageMAC, key []byte) bool {
-	expectedMAC := []byte(hex.EncodeToString(signString(message, key)))
-	return hmac.Equal(messageMAC, expectedMAC)
+	signature, _ := newHMACSigner(config.AlgHS512, string(sharedSecretKey)).Sign(stringToSign)
+	return signature
 }
 
 //verifyTime checks to make sure the encoded hmac we received is within the timeout threshold (default is 30 seconds).
 //The timeout is set in etc/bolt/config.json > security > verifyTimeout
 //It receives []byte of json that gets unmarshaled, checks that the timestamp in the unmarshaled data is less than 30 seconds old, and returns the decoded payload if it is.
-func verifyTime(decodedJSON []byte, verifyTimeout int64) (map[string]string, error) {
+//The current time comes from clock; the timestamp may be unix seconds, unix milliseconds or RFC 3339.
+func verifyTime(decodedJSON []byte, verifyTimeout int64, clock Clock) (map[string]string, error) {
 	payload := make(map[string]string)
 	err := json.Unmarshal(decodedJSON, &payload)
 	if err != nil {
-		return nil, err
+		return nil, malformed("payload", err)
 	}
 
-	time64, err := strconv.ParseInt(payload["timestamp"], 10, 64)
-	if err != nil {
+	if err := checkTimestamp(clock, payload["timestamp"], verifyTimeout); err != nil {
 		return nil, err
 	}
 
-	// Only process the request if the timestamp is within +-verifyTimeout seconds (default 30 seconds) of the current time
-	timeNow := time.Now().Unix()
-	if (timeNow-time64 > verifyTimeout) || (timeNow-time64 < -verifyTimeout) {
-		var buffer bytes.Buffer
-		buffer.WriteString("Security error- Invalid timestamp (")
-		buffer.WriteString(strconv.FormatInt(timeNow-time64, 10))
-		buffer.WriteString(") outside of verifyTime (+/- ")
-		buffer.WriteString(strconv.FormatInt(verifyTimeout, 10))
-		buffer.WriteString(")")
-		return nil, errors.New(buffer.String())
-	}
-
 	return payload, nil
 }
 
 //AuthenticateGroup takes a group name, the key they've submitted, and Config's groups+keys.
 //If the key & group received match a group within Config, return true (authentic).
 //If no match is found, return false.
+//The group's hmackey and keys may be argon2id or bcrypt hashes (see HashKey); keys are compared in constant time with VerifyKey.
+//Use AuthenticateWithStore to check keys held in a CredentialStore.
 func AuthenticateGroup(group string, key string, groups *[]config.SecurityGroups) (authenticated bool) {
-	for _, thisGroup := range *groups {
-		if thisGroup.Name == group && thisGroup.Hmackey == key {
-			return true
-		}
-	}
-	return false
+	return AuthenticateWithStore(NewConfigCredentialStore(groups), group, key)
 }
 
 //EncodeHMAC takes
@@ -96,11 +66,46 @@ func AuthenticateGroup(group string, key string, groups *[]config.SecurityGroups
 //It returns an encrypted message []byte or an error.
 //A message must be decoded within the timeout threshold (default of 30 seconds) of when it was encoded.
 func EncodeHMAC(key string, rawmessage string, timestamp string) (encodedmessage []byte, err error) {
+	return EncodeHMACWithNonce(key, rawmessage, timestamp, "")
+}
+
+//EncodeHMACWithNonce is EncodeHMAC with a nonce added to the signed payload, ex: from NewNonce.
+//DecodeHMACWithNonce rejects a second message with the same nonce, so a captured message can't be replayed within the timeout.
+//A blank nonce is left out, giving the same payload as EncodeHMAC.
+func EncodeHMACWithNonce(key string, rawmessage string, timestamp string, nonce string) (encodedmessage []byte, err error) {
+	return EncodeWithSigner(newHMACSigner(config.AlgHS512, key), "", rawmessage, timestamp, nonce)
+}
+
+//EncodeHMACForGroup encodes a message like EncodeHMACWithNonce (nonce may be blank), signing with the group's
+//current signing key (see config.SecurityGroups.SigningKey).  The key's id is sent as "kid" so the receiver
+//can pick the right key while keys are being rotated.
+func EncodeHMACForGroup(group config.SecurityGroups, rawmessage string, timestamp string, nonce string) (encodedmessage []byte, err error) {
+	key, ok := group.SigningKey(time.Now())
+	if !ok {
+		return nil, errors.New("Security error- No active key for group " + group.Name)
+	}
+	if key.Algorithm == config.AlgEdDSA {
+		return nil, errors.New("Security error- Group " + group.Name + " only holds the client's public key, so it can't sign")
+	}
+	signer, err := NewSigner(key.Algorithm, key.Key)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeWithSigner(signer, key.ID, rawmessage, timestamp, nonce)
+}
+
+//EncodeWithSigner encodes a message like EncodeHMACWithNonce (nonce may be blank), signing with signer.
+//The envelope names the signer's algorithm as "alg" and, if not blank, the key id as "kid".
+//Clients holding an Ed25519 private key use this with NewSigner(config.AlgEdDSA, privateKey).
+func EncodeWithSigner(signer Signer, kid string, rawmessage string, timestamp string, nonce string) (encodedmessage []byte, err error) {
 
 	// Create a json object with the message to encode and a timestamp
 	payload := make(map[string]string)
 	payload["timestamp"] = timestamp
 	payload["message"] = rawmessage
+	if nonce != "" {
+		payload["nonce"] = nonce
+	}
 
 	// Marshal the message into []byte
 	jsonBytes, err := json.Marshal(payload)
@@ -109,12 +114,19 @@ func EncodeHMAC(key string, rawmessage string, timestamp string) (encodedmessage
 	}
 
 	// Create the signed string.
-	signature := signString(jsonBytes, []byte(key))
+	signature, err := signer.Sign(jsonBytes)
+	if err != nil {
+		return nil, err
+	}
 
 	// Combine the encoded message with the key signature
 	jsonStr := map[string]string{
 		"data":      base64.URLEncoding.EncodeToString(jsonBytes),
 		"signature": base64.URLEncoding.EncodeToString([]byte(hex.EncodeToString(signature))),
+		"alg":       signer.Algorithm(),
+	}
+	if kid != "" {
+		jsonStr["kid"] = kid
 	}
 
 	// Marshal the encoded message and signature.
@@ -130,47 +142,174 @@ func EncodeHMAC(key string, rawmessage string, timestamp string) (encodedmessage
 //It matches the key with the group, then encodes the message using that key.
 //It returns the decoded message as a string or an error.
 //A message must be decoded within the timeout threshold (default is 30 seconds) of when it was encoded.
+//Errors match ErrMalformedEnvelope, ErrBadSignature or ErrExpired with errors.Is.  On error the returned string
+//only describes the step that failed, ex: "Error verifying time"; it never contains any of the received data.
 func DecodeHMAC(key string, encodedmessage []byte, verifyTimeout int64) (decodedMessage string, err error) {
+	payload, errMessage, err := decodePayload(newHMACSigner(config.AlgHS512, key), encodedmessage, verifyTimeout, SystemClock)
+	if err != nil {
+		return errMessage, err
+	}
+
+	// The timestamp in the payload is less than the timeout threshold.  Return the decoded message.
+	decodedMessage = payload["message"]
+	return decodedMessage, nil
+}
+
+//DecodeHMACWithNonce is DecodeHMAC for messages from EncodeHMACWithNonce.
+//It also rejects a message without a nonce, or whose nonce is already in store.
+//Nonces are kept for twice verifyTimeout, long enough to cover every timestamp DecodeHMAC would accept,
+//and are scoped to key, so messages signed with other keys never collide with them.
+func DecodeHMACWithNonce(key string, encodedmessage []byte, verifyTimeout int64, store NonceStore) (decodedMessage string, err error) {
+	payload, errMessage, err := decodePayload(newHMACSigner(config.AlgHS512, key), encodedmessage, verifyTimeout, SystemClock)
+	if err != nil {
+		return errMessage, err
+	}
+	if errMessage, err := checkNonce(payload, store, keyNonceScope(key), verifyTimeout); err != nil {
+		return errMessage, err
+	}
+
+	decodedMessage = payload["message"]
+	return decodedMessage, nil
+}
+
+//checkNonce rejects a payload without a nonce, or whose nonce is already in store for scope
+func checkNonce(payload map[string]string, store NonceStore, scope string, verifyTimeout int64) (errMessage string, err error) {
+	nonce := payload["nonce"]
+	if nonce == "" {
+		return "Error verifying nonce", malformed("missing nonce", nil)
+	}
+	fresh, err := store.CheckAndStore(scope, nonce, 2*time.Duration(verifyTimeout)*time.Second)
+	if err != nil {
+		return "Error verifying nonce", err
+	}
+	if !fresh {
+		return "Error verifying nonce", ErrReplayed
+	}
+	return "", nil
+}
+
+//keyNonceScope names the nonce scope of messages signed with key, without revealing the key
+func keyNonceScope(key string) string {
+	scope, _ := newHMACSigner(config.AlgHS256, key).Sign([]byte("nonce scope"))
+	return "key:" + hex.EncodeToString(scope[:8])
+}
+
+//DecodeHMACForGroup decodes a message like DecodeHMAC using the group's keys rather than a single key.
+//The key named by the message's kid is tried first, then every other key that may verify (see config.SecurityGroups.VerifyKeys),
+//so messages signed before a client learned the new key id still decode.  kid is the id of the key that verified the message.
+//Only keys using the envelope's algorithm are tried; envelopes without one are HS512.
+func DecodeHMACForGroup(group config.SecurityGroups, encodedmessage []byte, verifyTimeout int64) (decodedMessage string, kid string, err error) {
+	env, errMessage, err := parseEnvelope(encodedmessage)
+	if err != nil {
+		return errMessage, "", err
+	}
+
+	payload, kid, errMessage, err := env.verifyWithKeys(group.Name, group.VerifyKeys(time.Now()), verifyTimeout, SystemClock)
+	if err != nil {
+		return errMessage, "", err
+	}
+	return payload["message"], kid, nil
+}
+
+//envelope is an encoded message with its data and signature decoded
+type envelope struct {
+	data      []byte
+	signature []byte
+	kid       string
+	alg       string
+}
+
+//decodePayload checks the signature and timestamp of an encoded message and returns its payload.
+//On error it also returns the message DecodeHMAC has always returned in place of the decoded message.
+func decodePayload(verifier Verifier, encodedmessage []byte, verifyTimeout int64, clock Clock) (payload map[string]string, errMessage string, err error) {
+	env, errMessage, err := parseEnvelope(encodedmessage)
+	if err != nil {
+		return nil, errMessage, err
+	}
+	if env.alg != verifier.Algorithm() {
+		return nil, "Error verifying hmac", fmt.Errorf("%w (unexpected algorithm %s)", ErrBadSignature, env.alg)
+	}
+	return env.verify(verifier, verifyTimeout, clock)
+}
 
+//parseEnvelope unmarshals an encoded message and decodes its data and signature
+func parseEnvelope(encodedmessage []byte) (env *envelope, errMessage string, err error) {
 	type encodedStruct struct {
 		Data      string
 		Signature string
+		Kid       string
+		Alg       string
 	}
 	var enc encodedStruct
 	err = json.Unmarshal(encodedmessage, &enc)
 	if err != nil {
-		return "Error Unmarshalling encodedStruct", err
+		return nil, "Error Unmarshalling encodedStruct", malformed("envelope", err)
 	}
 
 	decodedJSON, err := base64.URLEncoding.DecodeString(enc.Data)
 	if err != nil {
 		decodedJSON, err = base64.StdEncoding.DecodeString(enc.Data)
 		if err != nil {
-			return "Error decoding Data", err
+			return nil, "Error decoding Data", malformed("data", err)
 		}
 	}
 
 	decodedSignature, err := base64.URLEncoding.DecodeString(enc.Signature)
 	// decodedSignature, err := base64.StdEncoding.DecodeString(enc.Signature)
 	if err != nil {
-		return "Error decoding Signature", err
+		return nil, "Error decoding Signature", malformed("signature", err)
 	}
 
-	// Sign the received message to verify that our signature matches the signature that was sent with the message
-	stringVerified := checkMAC(decodedJSON, decodedSignature, []byte(key))
+	// Envelopes from before algorithms could be chosen are HS512
+	alg := enc.Alg
+	if alg == "" {
+		alg = config.AlgHS512
+	}
+	return &envelope{data: decodedJSON, signature: decodedSignature, kid: enc.Kid, alg: alg}, "", nil
+}
+
+//verify checks the envelope's signature with verifier and its timestamp, and returns the payload
+func (env *envelope) verify(verifier Verifier, verifyTimeout int64, clock Clock) (payload map[string]string, errMessage string, err error) {
+	// Verify that the signature sent with the message is valid for the received message.  It's sent as hex text.
+	rawSignature, err := hex.DecodeString(string(env.signature))
+	stringVerified := err == nil && verifier.Verify(env.data, rawSignature)
 	if !stringVerified {
-		err := errors.New("Security error - Invalid signature")
-		// return "Error verifying hmac", err
-		return string(decodedSignature), err
+		return nil, "Error verifying hmac", ErrBadSignature
 	}
 
 	// Check that the timestamp is within the timeout threshold (default is 30 seconds)
-	payload, err := verifyTime(decodedJSON, verifyTimeout)
+	payload, err = verifyTime(env.data, verifyTimeout, clock)
 	if err != nil {
-		return "Error verifying time", err
+		return nil, "Error verifying time", err
 	}
+	return payload, "", nil
+}
 
-	// The timestamp in the payload is less than the timeout threshold.  Return the decoded message.
-	decodedMessage = payload["message"]
-	return decodedMessage, nil
+//verifyWithKeys verifies the envelope with the key named by its kid first, then the other keys using its algorithm,
+//and returns the payload and the id of the key that verified it
+func (env *envelope) verifyWithKeys(groupName string, keys []config.GroupKey, verifyTimeout int64, clock Clock) (payload map[string]string, kid string, errMessage string, err error) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].ID == env.kid && keys[j].ID != env.kid
+	})
+
+	errMessage, err = "Error verifying hmac", fmt.Errorf("%w (no key for group %s can verify it)", ErrBadSignature, groupName)
+	for _, key := range keys {
+		if key.Algorithm != env.alg {
+			continue
+		}
+		verifier, verr := NewVerifier(key.Algorithm, key.Key)
+		if verr != nil {
+			errMessage, err = "Error verifying hmac", verr
+			continue
+		}
+		payload, errMessage, err = env.verify(verifier, verifyTimeout, clock)
+		if err == nil {
+			return payload, key.ID, "", nil
+		}
+		if !errors.Is(err, ErrBadSignature) {
+			// The signature matched, so no other key will do better
+			break
+		}
+	}
+	return nil, "", errMessage, err
 }
@@ -0,0 +1,143 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"hash"
+
+	config "github.com/TeamFairmont/boltshared/config"
+)
+
+// Signer signs messages with one key and algorithm.  Clients sign with it and the engine uses it for HMAC groups.
+type Signer interface {
+	Algorithm() string
+	Sign(message []byte) ([]byte, error)
+}
+
+// Verifier checks signatures made by the matching Signer
+type Verifier interface {
+	Algorithm() string
+	Verify(message []byte, signature []byte) bool
+}
+
+// NewSigner returns a Signer for alg (config.AlgHS256, AlgHS512 or AlgEdDSA; blank is AlgHS512).
+// For the HMAC algorithms key is the shared secret.  For EdDSA it's the client's base64 Ed25519 private key or seed,
+// which never goes in the engine's config.
+func NewSigner(alg string, key string) (Signer, error) {
+	switch alg {
+	case "", config.AlgHS512, config.AlgHS256:
+		return newHMACSigner(alg, key), nil
+	case config.AlgEdDSA:
+		b, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, errors.New("Security error- EdDSA private key is not valid base64")
+		}
+		switch len(b) {
+		case ed25519.SeedSize:
+			return &ed25519Signer{key: ed25519.NewKeyFromSeed(b)}, nil
+		case ed25519.PrivateKeySize:
+			return &ed25519Signer{key: ed25519.PrivateKey(b)}, nil
+		}
+		return nil, errors.New("Security error- EdDSA private key must be a 32 byte seed or 64 byte private key")
+	}
+	return nil, errors.New("Security error- Unknown signature algorithm " + alg)
+}
+
+// NewVerifier returns a Verifier for alg (config.AlgHS256, AlgHS512 or AlgEdDSA; blank is AlgHS512).
+// For the HMAC algorithms key is the shared secret.  For EdDSA it's the client's base64 Ed25519 public key.
+func NewVerifier(alg string, key string) (Verifier, error) {
+	switch alg {
+	case "", config.AlgHS512, config.AlgHS256:
+		return newHMACSigner(alg, key), nil
+	case config.AlgEdDSA:
+		b, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(b) != ed25519.PublicKeySize {
+			return nil, errors.New("Security error- EdDSA public key must be 32 bytes of base64")
+		}
+		return &ed25519Verifier{key: ed25519.PublicKey(b)}, nil
+	}
+	return nil, errors.New("Security error- Unknown signature algorithm " + alg)
+}
+
+// GenerateEd25519Key returns a new base64 Ed25519 key pair.  The public key goes in the engine's config for the
+// group and the private key stays with the client.
+func GenerateEd25519Key() (publicKey string, privateKey string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub), base64.StdEncoding.EncodeToString(priv.Seed()), nil
+}
+
+// isHMACKey reports whether k may be used as an hmac secret: an HS256 or HS512 key that isn't a hash from HashKey.
+// EdDSA keys are public, so signing with one as a secret would let anyone sign.
+func isHMACKey(k config.GroupKey) bool {
+	return isHMACAlgorithm(k.Algorithm) && k.Key != "" && !config.IsHashedKey(k.Key)
+}
+
+// isHMACAlgorithm reports whether alg is HS256 or HS512, blank being HS512
+func isHMACAlgorithm(alg string) bool {
+	return alg == "" || alg == config.AlgHS512 || alg == config.AlgHS256
+}
+
+// hmacSigner signs and verifies with a shared secret
+type hmacSigner struct {
+	alg  string
+	hash func() hash.Hash
+	key  []byte
+}
+
+func newHMACSigner(alg string, key string) *hmacSigner {
+	if alg == config.AlgHS256 {
+		return &hmacSigner{alg: alg, hash: sha256.New, key: []byte(key)}
+	}
+	return &hmacSigner{alg: config.AlgHS512, hash: sha512.New, key: []byte(key)}
+}
+
+func (s *hmacSigner) Algorithm() string {
+	return s.alg
+}
+
+func (s *hmacSigner) Sign(message []byte) ([]byte, error) {
+	h := hmac.New(s.hash, s.key)
+	h.Write(message)
+	return h.Sum(nil), nil
+}
+
+func (s *hmacSigner) Verify(message []byte, signature []byte) bool {
+	expected, _ := s.Sign(message)
+	return hmac.Equal(signature, expected)
+}
+
+type ed25519Signer struct {
+	key ed25519.PrivateKey
+}
+
+func (s *ed25519Signer) Algorithm() string {
+	return config.AlgEdDSA
+}
+
+func (s *ed25519Signer) Sign(message []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, message), nil
+}
+
+type ed25519Verifier struct {
+	key ed25519.PublicKey
+}
+
+func (v *ed25519Verifier) Algorithm() string {
+	return config.AlgEdDSA
+}
+
+func (v *ed25519Verifier) Verify(message []byte, signature []byte) bool {
+	return ed25519.Verify(v.key, message, signature)
+}
@@ -0,0 +1,96 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignerVerifier(tst *testing.T) {
+	pub, priv, err := GenerateEd25519Key()
+	assert.Nil(tst, err, "No error")
+
+	for _, tc := range []struct{ alg, signKey, verifyKey string }{
+		{config.AlgHS256, "secret", "secret"},
+		{config.AlgHS512, "secret", "secret"},
+		{config.AlgEdDSA, priv, pub},
+	} {
+		signer, err := NewSigner(tc.alg, tc.signKey)
+		assert.Nil(tst, err, "No error creating "+tc.alg+" signer")
+		verifier, err := NewVerifier(tc.alg, tc.verifyKey)
+		assert.Nil(tst, err, "No error creating "+tc.alg+" verifier")
+		assert.Equal(tst, tc.alg, signer.Algorithm(), "Signer algorithm")
+		assert.Equal(tst, tc.alg, verifier.Algorithm(), "Verifier algorithm")
+
+		signature, err := signer.Sign([]byte("message"))
+		assert.Nil(tst, err, "No error signing")
+		assert.True(tst, verifier.Verify([]byte("message"), signature), tc.alg+" signature should verify")
+		assert.False(tst, verifier.Verify([]byte("other message"), signature), tc.alg+" signature should not verify another message")
+	}
+
+	_, err = NewSigner("none", "")
+	assert.NotNil(tst, err, "Unknown algorithm should fail")
+	_, err = NewVerifier(config.AlgEdDSA, "c2hvcnQ=")
+	assert.NotNil(tst, err, "Short public key should fail")
+}
+
+func TestEd25519Envelope(tst *testing.T) {
+	pub, priv, _ := GenerateEd25519Key()
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	group := config.SecurityGroups{Name: "partner", Algorithm: config.AlgEdDSA, Keys: []config.GroupKey{{ID: "p1", Key: pub}}}
+
+	// The client signs with its private key
+	signer, _ := NewSigner(config.AlgEdDSA, priv)
+	encoded, err := EncodeWithSigner(signer, "p1", "hello", now, "")
+	assert.Nil(tst, err, "No error")
+	var env map[string]string
+	json.Unmarshal(encoded, &env)
+	assert.Equal(tst, config.AlgEdDSA, env["alg"], "Envelope should name the algorithm")
+
+	// The engine verifies with only the public key
+	decoded, kid, err := DecodeHMACForGroup(group, encoded, 30)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, "hello", decoded, "Message should decode")
+	assert.Equal(tst, "p1", kid, "The public key verified it")
+
+	_, err = EncodeHMACForGroup(group, "hello", now, "")
+	assert.NotNil(tst, err, "The engine can't sign for an EdDSA group")
+
+	// An HMAC envelope signed with the public key as the secret must not be accepted
+	forged, _ := EncodeWithSigner(newHMACSigner(config.AlgHS512, pub), "p1", "hello", now, "")
+	_, _, err = DecodeHMACForGroup(group, forged, 30)
+	assert.NotNil(tst, err, "Algorithm must match the group's")
+
+	// Nor through GetKeyFromGroup then DecodeHMAC, or as a simple auth key, for groups keyed by keys or by hmackey
+	groups := []config.SecurityGroups{group, {Name: "partner2", Algorithm: config.AlgEdDSA, Hmackey: pub}}
+	for _, g := range groups {
+		key, err := GetKeyFromGroup(g.Name, &groups)
+		assert.True(tst, errors.Is(err, ErrNoCredential), "EdDSA group has no hmac key")
+		_, err = DecodeHMAC(key, forged, 30)
+		assert.NotNil(tst, err, "Message signed with the public key must be rejected")
+		assert.False(tst, AuthenticateGroup(g.Name, pub, &groups), "The public key doesn't authenticate")
+	}
+
+	// Envelopes without an algorithm are HS512
+	legacy := config.SecurityGroups{Name: "legacy", Hmackey: "secret"}
+	encoded, _ = EncodeHMAC("secret", "hello", now)
+	var withoutAlg map[string]string
+	json.Unmarshal(encoded, &withoutAlg)
+	delete(withoutAlg, "alg")
+	encoded, _ = json.Marshal(withoutAlg)
+	decoded, _, err = DecodeHMACForGroup(legacy, encoded, 30)
+	assert.Nil(tst, err, "Envelope without alg should decode")
+	assert.Equal(tst, "hello", decoded, "Message should decode")
+	decoded, err = DecodeHMAC("secret", encoded, 30)
+	assert.Nil(tst, err, "Envelope without alg should decode")
+	assert.Equal(tst, "hello", decoded, "Message should decode")
+}
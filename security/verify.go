@@ -0,0 +1,86 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+)
+
+// DefaultVerifyTimeout is the verifyTimeout in seconds used by a MessageVerifier that doesn't set one, matching the config default
+const DefaultVerifyTimeout = 30
+
+// KeyLookup returns the keys that may verify a message from group at now, or ErrUnknownGroup
+type KeyLookup func(group string, now time.Time) ([]config.GroupKey, error)
+
+// GroupKeys returns a KeyLookup over the groups in cfg.Security.Groups, using each group's VerifyKeys
+func GroupKeys(groups *[]config.SecurityGroups) KeyLookup {
+	return func(group string, now time.Time) ([]config.GroupKey, error) {
+		for _, g := range *groups {
+			if g.Name == group {
+				return g.VerifyKeys(now), nil
+			}
+		}
+		return nil, ErrUnknownGroup
+	}
+}
+
+// MessageVerifier decodes messages from EncodeHMAC, EncodeHMACWithNonce, EncodeHMACForGroup and EncodeWithSigner,
+// with each part of the check set by its fields rather than by which Decode function is called.
+// Keys is required; the zero value of every other field uses the same behavior as DecodeHMACForGroup.
+type MessageVerifier struct {
+	Keys          KeyLookup  // where to find a group's keys, ex: GroupKeys(&cfg.Security.Groups)
+	VerifyTimeout int64      // seconds either side of the current time a timestamp may be, DefaultVerifyTimeout if 0
+	Clock         Clock      // the current time, SystemClock if nil
+	Nonces        NonceStore // if set, messages must carry a nonce that the group hasn't used before
+}
+
+// NewMessageVerifier returns a MessageVerifier using the groups and verifyTimeout in cfg.  Set Clock or Nonces on it as needed.
+func NewMessageVerifier(cfg *config.Config) *MessageVerifier {
+	return NewMessageVerifierWithStore(cfg, NewConfigCredentialStore(&cfg.Security.Groups))
+}
+
+// NewMessageVerifierWithStore is NewMessageVerifier taking the groups' keys from store (see StoreKeys),
+// so a credential revoked in the store stops verifying at once
+func NewMessageVerifierWithStore(cfg *config.Config, store CredentialStore) *MessageVerifier {
+	return &MessageVerifier{
+		Keys:          StoreKeys(store),
+		VerifyTimeout: cfg.Security.VerifyTimeout,
+	}
+}
+
+// Decode checks a message from group and returns it, along with the id of the key that verified it.
+// Errors are the same as DecodeHMACForGroup's, plus ErrUnknownGroup and, with Nonces, ErrReplayed.
+// Timestamps may be unix seconds, unix milliseconds or RFC 3339.
+func (v *MessageVerifier) Decode(group string, encodedmessage []byte) (decodedMessage string, kid string, err error) {
+	clock := v.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	verifyTimeout := v.VerifyTimeout
+	if verifyTimeout == 0 {
+		verifyTimeout = DefaultVerifyTimeout
+	}
+
+	keys, err := v.Keys(group, clock.Now())
+	if err != nil {
+		return "Error verifying group", "", err
+	}
+	env, errMessage, err := parseEnvelope(encodedmessage)
+	if err != nil {
+		return errMessage, "", err
+	}
+	payload, kid, errMessage, err := env.verifyWithKeys(group, keys, verifyTimeout, clock)
+	if err != nil {
+		return errMessage, "", err
+	}
+	if v.Nonces != nil {
+		if errMessage, err := checkNonce(payload, v.Nonces, group, verifyTimeout); err != nil {
+			return errMessage, "", err
+		}
+	}
+	return payload["message"], kid, nil
+}
@@ -0,0 +1,81 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package security
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	config "github.com/TeamFairmont/boltshared/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageVerifier(tst *testing.T) {
+	cfg, err := config.DefaultConfig()
+	assert.Nil(tst, err, "No error")
+	cfg.Security.Groups = []config.SecurityGroups{{Name: "test01", Hmackey: "01234567890~!@#$%^&*-_=+ABCabc"}}
+
+	start := time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC)
+	clock := NewFakeClock(start)
+	v := NewMessageVerifier(cfg)
+	v.Clock = clock
+	assert.Equal(tst, int64(30), v.VerifyTimeout, "verifyTimeout should come from the config")
+
+	encoded, _ := EncodeHMAC("01234567890~!@#$%^&*-_=+ABCabc", "hello", strconv.FormatInt(start.UnixMilli(), 10))
+	decoded, kid, err := v.Decode("test01", encoded)
+	assert.Nil(tst, err, "Message should decode at the fake time")
+	assert.Equal(tst, "hello", decoded, "Message should decode")
+	assert.Equal(tst, "", kid, "The hmackey has no id")
+
+	clock.Advance(31 * time.Second)
+	decoded, _, err = v.Decode("test01", encoded)
+	assert.True(tst, errors.Is(err, ErrExpired), "Message should expire with the fake clock")
+	assert.Equal(tst, "Error verifying time", decoded, "Should report the failed step")
+
+	_, _, err = v.Decode("nogroup", encoded)
+	assert.True(tst, errors.Is(err, ErrUnknownGroup), "Unknown group should fail")
+
+	// With a nonce store, replays are rejected
+	clock.Set(start)
+	v.Nonces = NewMemoryNonceStore(10)
+	nonce, _ := NewNonce()
+	encoded, _ = EncodeHMACWithNonce("01234567890~!@#$%^&*-_=+ABCabc", "hello", start.Format(time.RFC3339), nonce)
+	_, _, err = v.Decode("test01", encoded)
+	assert.Nil(tst, err, "First use should decode")
+	_, _, err = v.Decode("test01", encoded)
+	assert.True(tst, errors.Is(err, ErrReplayed), "Second use should be replayed")
+}
+
+func TestMessageVerifierKeyLookup(tst *testing.T) {
+	start := time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC)
+	expires := start.Add(time.Hour)
+	groups := []config.SecurityGroups{{
+		Name: "test01",
+		Keys: []config.GroupKey{{ID: "k1", Key: "key one", NotAfter: &expires}},
+	}}
+	clock := NewFakeClock(start)
+	v := &MessageVerifier{Keys: GroupKeys(&groups), Clock: clock}
+
+	signer, _ := NewSigner(config.AlgHS512, "key one")
+	encoded, err := EncodeWithSigner(signer, "k1", "hello", strconv.FormatInt(start.Unix(), 10), "")
+	assert.Nil(tst, err, "No error")
+	decoded, kid, err := v.Decode("test01", encoded)
+	assert.Nil(tst, err, "No error")
+	assert.Equal(tst, "hello", decoded, "Message should decode")
+	assert.Equal(tst, "k1", kid, "Key id should be returned")
+
+	// Key windows follow the clock too, and the verifyTimeout defaults to 30 seconds
+	v.VerifyTimeout = 7200
+	clock.Advance(2 * time.Hour)
+	_, _, err = v.Decode("test01", encoded)
+	assert.True(tst, errors.Is(err, ErrBadSignature), "Expired key should not verify")
+
+	v.VerifyTimeout = 0
+	clock.Set(start.Add(31 * time.Second))
+	_, _, err = v.Decode("test01", encoded)
+	assert.True(tst, errors.Is(err, ErrExpired), "Default timeout should be 30 seconds")
+}